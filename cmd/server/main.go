@@ -2,11 +2,16 @@ package main
 
 import (
 	"context"
+	"errors"
+	"expvar"
 	"github.com/Sayan80bayev/go-project/pkg/logging"
 	"github.com/gin-gonic/gin"
+	"net/http"
 	"notificationService/cmd/server/ws"
 	"notificationService/internal/bootstrap"
 	"notificationService/internal/router"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
@@ -19,23 +24,89 @@ func main() {
 
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
+	// gin trusts every proxy by default, which lets any client pick its own
+	// IP through X-Forwarded-For and dodge the per-IP handshake limit
+	if err := r.SetTrustedProxies(ctn.Config.TrustedProxies); err != nil {
+		panic(err)
+	}
 	r.Use(gin.Recovery())
 	r.Use(logging.Middleware)
 
-	ctx, cancel := context.WithCancel(context.Background())
-	go ctn.Consumer.Start(ctx)
-	defer func() {
-		cancel()
-		ctn.Consumer.Close()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// the consumer stops first and the hub's backplane and presence last, so
+	// notifications handled during shutdown still reach connected sockets
+	consumerCtx, cancelConsumer := context.WithCancel(context.Background())
+	appCtx, cancelApp := context.WithCancel(context.Background())
+	ws.UseBackplane(appCtx, ctn.Backplane)
+	ws.UsePresence(appCtx, ctn.Presence)
+	ws.UseTopicAuthorizer(ctn.TopicAuthorizer)
+	go ctn.Consumer.Start(consumerCtx)
+
+	router.RegisterNotificationRoutes(r, ctn.NotificationService, ctn.Verifier, ctn.Config.ServicePushGrant)
+	router.RegisterAdminRoutes(r, ctn.NotificationService, ctn.Verifier)
+	ws.SetupWebSocketRoutes(r, ctn.Verifier, ctn.Tickets, ctn.RateLimiter, ctn.NotificationService, ctn.WSConfig)
+
+	// expvar exposes the command line and memory stats, so it is only served
+	// on the internal metrics listener, never on the public router
+	var metricsSrv *http.Server
+	if ctn.Config.MetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/debug/vars", expvar.Handler())
+		metricsSrv = &http.Server{Addr: ctn.Config.MetricsAddr, Handler: mux}
+		go func() {
+			log.Info("metrics are served on " + ctn.Config.MetricsAddr)
+			if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Errorf("metrics listener: %v", err)
+			}
+		}()
+	}
+
+	srv := &http.Server{
+		Addr:    ":" + ctn.Config.Port,
+		Handler: r,
+	}
+	go func() {
+		log.Info("server is running on port " + ctn.Config.Port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("can't start server: %v", err)
+		}
 	}()
 
-	router.RegisterNotificationRoutes(r, ctn.NotificationService)
-	ws.SetupWebSocketRoutes(r, ctn.JWKSUrl)
-	log.Info("server is running on port " + ctn.Config.Port)
-	err = r.Run(":" + ctn.Config.Port)
-	if err != nil {
-		log.Fatal("can't start server")
-		return
+	<-ctx.Done()
+	stop()
+	log.Info("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ctn.Config.ShutdownTimeout)
+	defer cancel()
+
+	cancelConsumer()
+	ctn.Consumer.Close()
+
+	// Shutdown does not track hijacked WebSocket connections, so the hub is
+	// drained alongside it once the listener is closed
+	drained := make(chan error, 1)
+	srv.RegisterOnShutdown(func() { drained <- ws.Drain(shutdownCtx) })
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Errorf("http shutdown: %v", err)
+	}
+	if err := <-drained; err != nil {
+		log.Errorf("draining sockets: %v", err)
+	}
+	if metricsSrv != nil {
+		_ = metricsSrv.Shutdown(shutdownCtx)
+	}
+
+	cancelApp()
+	select {
+	case <-ctn.Presence.Stopped():
+	case <-shutdownCtx.Done():
 	}
 
+	ctn.Producer.Close()
+	_ = ctn.Backplane.Close()
+	_ = ctn.RedisClient.Close()
+	_ = ctn.DB.Close()
+	log.Info("server stopped")
 }
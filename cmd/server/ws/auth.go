@@ -0,0 +1,136 @@
+package ws
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"net/http"
+	"notificationService/internal/auth"
+	"strings"
+	"time"
+)
+
+const (
+	ticketKeyPrefix = "ws:ticket:"
+
+	// Browsers cannot set headers on a WebSocket handshake, so credentials
+	// may ride in Sec-WebSocket-Protocol as "ticket.<ticket>" or
+	// "access_token.<jwt>". Clients must also offer a protocol the server can
+	// select, such as notif.v1.json.
+	ticketProtocolPrefix = "ticket."
+	tokenProtocolPrefix  = "access_token."
+)
+
+var ErrInvalidTicket = errors.New("invalid or expired ticket")
+
+// TicketStore issues short-lived, single-use tickets that stand in for the
+// access token on the handshake, so long-lived JWTs never reach URLs or logs.
+type TicketStore interface {
+	Issue(ctx context.Context, claims *auth.Claims, ttl time.Duration) (string, error)
+	Redeem(ctx context.Context, ticket string) (*auth.Claims, error)
+}
+
+// RedisTicketStore keeps tickets in Redis so a ticket issued by one replica
+// can be redeemed on another. It talks to Redis directly rather than through
+// the cache service, whose debug logs would print the ticket in the key.
+type RedisTicketStore struct {
+	client redis.Cmdable
+}
+
+func NewRedisTicketStore(client redis.Cmdable) *RedisTicketStore {
+	return &RedisTicketStore{client: client}
+}
+
+func (s *RedisTicketStore) Issue(ctx context.Context, claims *auth.Claims, ttl time.Duration) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(buf)
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	if err := s.client.Set(ctx, ticketKeyPrefix+ticket, data, ttl).Err(); err != nil {
+		return "", err
+	}
+	return ticket, nil
+}
+
+// Redeem reads and deletes the ticket in one GETDEL, so two concurrent
+// handshakes can never both redeem it.
+func (s *RedisTicketStore) Redeem(ctx context.Context, ticket string) (*auth.Claims, error) {
+	data, err := s.client.GetDel(ctx, ticketKeyPrefix+ticket).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrInvalidTicket
+	}
+	if err != nil {
+		return nil, err
+	}
+	var claims auth.Claims
+	if err := json.Unmarshal([]byte(data), &claims); err != nil {
+		return nil, ErrInvalidTicket
+	}
+	return &claims, nil
+}
+
+// handshakeCredentials lets the streaming endpoints authenticate without an
+// Authorization header: by a `ticket` query parameter or a ticket or token
+// subprotocol, in that order. Raw tokens are never read from the URL, where
+// proxies and access logs would record them.
+func handshakeCredentials(verifier *auth.Verifier, tickets TicketStore) auth.CredentialSource {
+	return func(c *gin.Context) (*auth.Claims, error) {
+		if ticket := c.Query("ticket"); ticket != "" {
+			return tickets.Redeem(c.Request.Context(), ticket)
+		}
+		for _, p := range websocketProtocols(c.Request) {
+			if ticket, ok := strings.CutPrefix(p, ticketProtocolPrefix); ok {
+				return tickets.Redeem(c.Request.Context(), ticket)
+			}
+			if token, ok := strings.CutPrefix(p, tokenProtocolPrefix); ok {
+				return verifier.Verify(token)
+			}
+		}
+		return nil, nil
+	}
+}
+
+func websocketProtocols(r *http.Request) []string {
+	var protocols []string
+	for _, h := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(h, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				protocols = append(protocols, p)
+			}
+		}
+	}
+	return protocols
+}
+
+// HandleIssueTicket hands an authenticated caller a single-use ticket for
+// opening /ws, /events or /poll. A ticket opens one connection; reconnecting
+// takes a new one.
+func HandleIssueTicket(tickets TicketStore, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		val, exists := c.Get("claims")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "claims missing in context"})
+			return
+		}
+		claims := val.(*auth.Claims)
+
+		ticket, err := tickets.Issue(c.Request.Context(), claims, ttl)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to issue ticket"})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{
+			"ticket":     ticket,
+			"expires_in": int(ttl.Seconds()),
+		})
+	}
+}
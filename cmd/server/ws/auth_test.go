@@ -0,0 +1,113 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"notificationService/internal/auth"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTicketStore(t *testing.T) (*RedisTicketStore, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return NewRedisTicketStore(client), mr
+}
+
+func TestTicketRedeemsOnlyOnce(t *testing.T) {
+	ctx := context.Background()
+	store, mr := newTicketStore(t)
+
+	user := uuid.New()
+	ticket, err := store.Issue(ctx, &auth.Claims{UserID: user}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// concurrent handshakes race for the same ticket; exactly one may win
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		redeemed int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			claims, err := store.Redeem(ctx, ticket)
+			if errors.Is(err, ErrInvalidTicket) {
+				return
+			}
+			if err != nil || claims.UserID != user {
+				t.Errorf("redeem: got %+v, %v", claims, err)
+				return
+			}
+			mu.Lock()
+			redeemed++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if redeemed != 1 {
+		t.Fatalf("ticket redeemed %d times, want 1", redeemed)
+	}
+
+	expiring, _ := store.Issue(ctx, &auth.Claims{UserID: user}, time.Second)
+	mr.FastForward(2 * time.Second)
+	if _, err := store.Redeem(ctx, expiring); !errors.Is(err, ErrInvalidTicket) {
+		t.Fatalf("expired ticket: got %v, want ErrInvalidTicket", err)
+	}
+}
+
+func TestHandshakeCredentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store, _ := newTicketStore(t)
+	user := uuid.New()
+	issue := func() string {
+		ticket, err := store.Issue(context.Background(), &auth.Claims{UserID: user}, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ticket
+	}
+
+	for _, tc := range []struct {
+		name     string
+		query    string
+		protocol string
+		want     int
+	}{
+		{"ticket query", "ticket=" + issue(), "", http.StatusOK},
+		{"ticket subprotocol", "", "notif.v1.json, ticket." + issue(), http.StatusOK},
+		{"unknown ticket", "ticket=nope", "", http.StatusUnauthorized},
+		{"token in the URL", "access_token=eyJhbGciOi.e30.sig", "", http.StatusUnauthorized},
+		{"no credentials", "", "notif.v1.json", http.StatusUnauthorized},
+	} {
+		r := gin.New()
+		r.GET("/ws", auth.Authenticate(nil, handshakeCredentials(nil, store)), func(c *gin.Context) {
+			if got, _ := c.Get("user_id"); got != user {
+				t.Errorf("%s: user_id is %v, want %s", tc.name, got, user)
+			}
+			c.Status(http.StatusOK)
+		})
+		req := httptest.NewRequest(http.MethodGet, "/ws?"+tc.query, nil)
+		if tc.protocol != "" {
+			req.Header.Set("Sec-WebSocket-Protocol", tc.protocol)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, w.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package ws
+
+import (
+	"context"
+	"github.com/Sayan80bayev/go-project/pkg/logging"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+)
+
+const (
+	userChannelPrefix  = "user:"
+	topicChannelPrefix = "topic:"
+
+	redisChannelPrefix = "ws:"
+	controlChannel     = "ws:control"
+)
+
+// DeliverFunc hands a message received from the backplane to local sockets.
+type DeliverFunc func(channel string, payload []byte)
+
+// Backplane carries hub messages between service instances so a message
+// published on one replica reaches sockets held by any other. Channels name
+// either a user's inbox ("user:<id>") or a topic ("topic:<name>").
+type Backplane interface {
+	Publish(ctx context.Context, channel string, payload []byte) error
+	Subscribe(ctx context.Context, channel string) error
+	Unsubscribe(ctx context.Context, channel string) error
+	Start(ctx context.Context, deliver DeliverFunc)
+	Close() error
+}
+
+// MemoryBackplane delivers in-process only; suitable for a single node and tests.
+type MemoryBackplane struct {
+	mu      sync.RWMutex
+	deliver DeliverFunc
+}
+
+func NewMemoryBackplane() *MemoryBackplane {
+	return &MemoryBackplane{}
+}
+
+func (b *MemoryBackplane) Publish(_ context.Context, channel string, payload []byte) error {
+	b.mu.RLock()
+	deliver := b.deliver
+	b.mu.RUnlock()
+	if deliver != nil {
+		deliver(channel, payload)
+	}
+	return nil
+}
+
+func (b *MemoryBackplane) Subscribe(context.Context, string) error   { return nil }
+func (b *MemoryBackplane) Unsubscribe(context.Context, string) error { return nil }
+
+func (b *MemoryBackplane) Start(_ context.Context, deliver DeliverFunc) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deliver = deliver
+}
+
+func (b *MemoryBackplane) Close() error { return nil }
+
+// RedisBackplane publishes to a Redis channel per user or topic; each instance
+// subscribes to the channels of users and topics it currently holds sockets for.
+// It talks to Redis directly rather than through the cache service, whose
+// debug logs would print every message.
+type RedisBackplane struct {
+	client redis.UniversalClient
+	pubsub *redis.PubSub
+	log    *logrus.Logger
+}
+
+func NewRedisBackplane(client redis.UniversalClient) *RedisBackplane {
+	return &RedisBackplane{
+		client: client,
+		pubsub: client.Subscribe(context.Background(), controlChannel),
+		log:    logging.GetLogger(),
+	}
+}
+
+func (b *RedisBackplane) Publish(ctx context.Context, channel string, payload []byte) error {
+	return b.client.Publish(ctx, redisChannelPrefix+channel, payload).Err()
+}
+
+func (b *RedisBackplane) Subscribe(ctx context.Context, channel string) error {
+	return b.pubsub.Subscribe(ctx, redisChannelPrefix+channel)
+}
+
+func (b *RedisBackplane) Unsubscribe(ctx context.Context, channel string) error {
+	return b.pubsub.Unsubscribe(ctx, redisChannelPrefix+channel)
+}
+
+func (b *RedisBackplane) Start(ctx context.Context, deliver DeliverFunc) {
+	go func() {
+		ch := b.pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				channel, ok := strings.CutPrefix(msg.Channel, redisChannelPrefix)
+				if !ok || msg.Channel == controlChannel {
+					continue
+				}
+				deliver(channel, []byte(msg.Payload))
+			}
+		}
+	}()
+	b.log.Info("Redis hub backplane started")
+}
+
+func (b *RedisBackplane) Close() error {
+	return b.pubsub.Close()
+}
+
+func userChannel(userID uuid.UUID) string {
+	return userChannelPrefix + userID.String()
+}
+
+func topicChannel(topic string) string {
+	return topicChannelPrefix + topic
+}
+
+// channelRefs counts local interest in backplane channels so the hub can
+// subscribe and unsubscribe outside its own lock. Network calls for one
+// channel are serialized by that channel's mutex and always converge on
+// the latest count, so a quick leave and rejoin cannot end unsubscribed.
+type channelRefs struct {
+	mu    sync.Mutex
+	chans map[string]*channelRef
+}
+
+type channelRef struct {
+	// mu orders Subscribe and Unsubscribe calls for the channel
+	mu         sync.Mutex
+	subscribed bool // guarded by mu
+
+	// refs and inflight are guarded by channelRefs.mu; the entry is dropped
+	// once nobody is interested or holds it
+	refs     int
+	inflight int
+}
+
+func newChannelRefs() *channelRefs {
+	return &channelRefs{chans: make(map[string]*channelRef)}
+}
+
+// acquire and release move the count for channel and bring the backplane
+// subscription in line with it. Callers must not hold the hub lock.
+func (c *channelRefs) acquire(b Backplane, channel string) { c.adjust(b, channel, 1) }
+func (c *channelRefs) release(b Backplane, channel string) { c.adjust(b, channel, -1) }
+
+func (c *channelRefs) adjust(b Backplane, channel string, delta int) {
+	c.mu.Lock()
+	ref, ok := c.chans[channel]
+	if !ok {
+		ref = &channelRef{}
+		c.chans[channel] = ref
+	}
+	ref.refs += delta
+	ref.inflight++
+	c.mu.Unlock()
+
+	ref.mu.Lock()
+	c.mu.Lock()
+	want := ref.refs > 0
+	c.mu.Unlock()
+	switch {
+	case want && !ref.subscribed:
+		if err := b.Subscribe(context.Background(), channel); err != nil {
+			logging.GetLogger().Errorf("backplane subscribe for %s failed: %v", channel, err)
+		} else {
+			ref.subscribed = true
+		}
+	case !want && ref.subscribed:
+		if err := b.Unsubscribe(context.Background(), channel); err != nil {
+			logging.GetLogger().Errorf("backplane unsubscribe for %s failed: %v", channel, err)
+		}
+		ref.subscribed = false
+	}
+	ref.mu.Unlock()
+
+	c.mu.Lock()
+	ref.inflight--
+	// with nobody in flight, no other goroutine can hold ref.mu; a negative
+	// count (a release that overtook its acquire) is kept until it settles
+	if ref.refs == 0 && ref.inflight == 0 && !ref.subscribed {
+		delete(c.chans, channel)
+	}
+	c.mu.Unlock()
+}
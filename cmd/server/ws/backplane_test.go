@@ -0,0 +1,69 @@
+package ws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// newRedisHub starts a hub on its own Redis connection, as one replica would
+func newRedisHub(t *testing.T, mr *miniredis.Miniredis) *Hub {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	b := NewRedisBackplane(client)
+	t.Cleanup(func() {
+		_ = b.Close()
+		_ = client.Close()
+	})
+	return newHub(b)
+}
+
+// waitSubscribers waits until Redis reports n subscribers on a hub channel
+func waitSubscribers(t *testing.T, mr *miniredis.Miniredis, channel string, n int) {
+	t.Helper()
+	name := redisChannelPrefix + channel
+	deadline := time.Now().Add(time.Second)
+	for mr.PubSubNumSub(name)[name] != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s has %d subscribers, want %d", name, mr.PubSubNumSub(name)[name], n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRedisBackplaneDeliversAcrossInstances(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a, b := newRedisHub(t, mr), newRedisHub(t, mr)
+	user := uuid.New()
+	sub := NewRecorder(user)
+	if err := b.Register(sub); err != nil {
+		t.Fatal(err)
+	}
+	waitSubscribers(t, mr, userChannel(user), 1)
+
+	env, _ := NewEnvelope(EventMessage, "", "from a")
+	a.Publish(user, env)
+	if err := sub.Expect(EventMessage); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Join(sub, "post:1"); err != nil {
+		t.Fatal(err)
+	}
+	waitSubscribers(t, mr, topicChannel("post:1"), 1)
+	a.PublishTopic("post:1", env)
+	if err := sub.Expect(EventMessage); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Unregister(sub)
+	waitSubscribers(t, mr, userChannel(user), 0)
+	waitSubscribers(t, mr, topicChannel("post:1"), 0)
+	a.Publish(user, env)
+	if err := sub.ExpectNothing(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,107 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Sayan80bayev/go-project/pkg/logging"
+	"github.com/Sayan80bayev/go-project/pkg/middleware"
+	"github.com/google/uuid"
+	"notificationService/internal/auth"
+)
+
+// broadcastChannel is subscribed by every instance for the lifetime of the hub.
+const broadcastChannel = "broadcast"
+
+// Segment selects broadcast recipients among connected users. Each non-empty
+// criterion must match; an empty segment matches every connection.
+type Segment struct {
+	UserIDs []uuid.UUID       `json:"user_ids,omitempty"`
+	Roles   []middleware.Role `json:"roles,omitempty"`
+}
+
+// claimed is implemented by subscribers that know their caller's token claims.
+type claimed interface {
+	currentClaims() *auth.Claims
+}
+
+type broadcastMessage struct {
+	Segment  Segment  `json:"segment"`
+	Envelope Envelope `json:"envelope"`
+}
+
+func (s Segment) matches(sub Subscriber) bool {
+	if len(s.UserIDs) > 0 {
+		found := false
+		for _, id := range s.UserIDs {
+			if id == sub.Owner() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(s.Roles) > 0 {
+		c, ok := sub.(claimed)
+		if !ok {
+			return false
+		}
+		claims := c.currentClaims()
+		if claims == nil || !claims.HasRole(s.Roles...) {
+			return false
+		}
+	}
+	return true
+}
+
+// Broadcast pushes a typed event to every connection in segment, on every
+// instance. Segments naming only users go straight to their channels.
+func Broadcast(segment Segment, eventType string, payload interface{}) error {
+	env, err := NewEnvelope(eventType, "", payload)
+	if err != nil {
+		return err
+	}
+	if len(segment.UserIDs) > 0 && len(segment.Roles) == 0 {
+		for _, id := range segment.UserIDs {
+			hub.Publish(id, env)
+		}
+		return nil
+	}
+
+	data, err := json.Marshal(broadcastMessage{Segment: segment, Envelope: env})
+	if err != nil {
+		return err
+	}
+	hub.mu.RLock()
+	b := hub.backplane
+	hub.mu.RUnlock()
+	return b.Publish(context.Background(), broadcastChannel, data)
+}
+
+// deliverBroadcast fans a broadcast out to matching local connections.
+func (h *Hub) deliverBroadcast(payload []byte) {
+	var msg broadcastMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		logging.GetLogger().Errorf("backplane: malformed broadcast: %v", err)
+		return
+	}
+	h.mu.RLock()
+	var subs []Subscriber
+	for _, conns := range h.clients {
+		for _, s := range conns {
+			if _, ok := s.(transient); ok {
+				continue
+			}
+			if msg.Segment.matches(s) {
+				subs = append(subs, s)
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	metricBroadcastDeliveries.Add(int64(len(subs)))
+	for _, s := range subs {
+		s.Send(msg.Envelope)
+	}
+}
@@ -0,0 +1,45 @@
+package ws
+
+import (
+	"notificationService/internal/auth"
+	"testing"
+
+	"github.com/Sayan80bayev/go-project/pkg/middleware"
+	"github.com/google/uuid"
+)
+
+// claimedRecorder is a Recorder whose caller holds claims, as sockets and
+// SSE streams do
+type claimedRecorder struct {
+	*Recorder
+	claims *auth.Claims
+}
+
+func (r claimedRecorder) currentClaims() *auth.Claims { return r.claims }
+
+func TestSegmentMatches(t *testing.T) {
+	user, other := uuid.New(), uuid.New()
+	admin := claimedRecorder{NewRecorder(user), &auth.Claims{UserID: user, Roles: []middleware.Role{middleware.RoleAdmin}}}
+	plain := claimedRecorder{NewRecorder(user), &auth.Claims{UserID: user}}
+	anonymous := NewRecorder(user)
+
+	for _, tc := range []struct {
+		name    string
+		segment Segment
+		sub     Subscriber
+		want    bool
+	}{
+		{"empty segment", Segment{}, anonymous, true},
+		{"listed user", Segment{UserIDs: []uuid.UUID{other, user}}, anonymous, true},
+		{"unlisted user", Segment{UserIDs: []uuid.UUID{other}}, anonymous, false},
+		{"role held", Segment{Roles: []middleware.Role{middleware.RoleAdmin}}, admin, true},
+		{"role missing", Segment{Roles: []middleware.Role{middleware.RoleAdmin}}, plain, false},
+		{"role without claims", Segment{Roles: []middleware.Role{middleware.RoleAdmin}}, anonymous, false},
+		{"user and role both match", Segment{UserIDs: []uuid.UUID{user}, Roles: []middleware.Role{middleware.RoleAdmin}}, admin, true},
+		{"role matches but user does not", Segment{UserIDs: []uuid.UUID{other}, Roles: []middleware.Role{middleware.RoleAdmin}}, admin, false},
+	} {
+		if got := tc.segment.matches(tc.sub); got != tc.want {
+			t.Errorf("%s: matches=%v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -1,34 +1,85 @@
 package ws
 
 import (
-	"encoding/json"
+	"errors"
 	"github.com/Sayan80bayev/go-project/pkg/logging"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
+	"net"
+	"notificationService/internal/auth"
+	"sync"
 	"time"
 )
 
 type Client struct {
+	ID     uuid.UUID
 	UserID uuid.UUID
 	Conn   *websocket.Conn
-	SendCh chan interface{}
+	SendCh chan Envelope
 	log    *logrus.Logger
+	cfg    Config
+	inbox  InboxService
+	codec  Codec
+
+	// while replaying, live messages are held in pending so they can be
+	// de-duplicated against the replayed backlog
+	mu        sync.Mutex
+	replaying bool
+	pending   []Envelope
+	dropped   int
+	closing   bool
+	inflight  map[string]*inflightPush
+	attempts  map[uuid.UUID]int
+	expiresAt time.Time
+	claims    *auth.Claims
+
+	verifier *auth.Verifier
+	reauthed chan struct{}
+	// attemptsReady wakes recordAttempts when attempts has unsaved counts
+	attemptsReady chan struct{}
+
+	done      chan struct{}
+	closeOnce sync.Once
+	draining  chan struct{}
+	drainOnce sync.Once
 }
 
-func NewClient(userID uuid.UUID, conn *websocket.Conn) *Client {
+func NewClient(userID uuid.UUID, conn *websocket.Conn, cfg Config, inbox InboxService) *Client {
 	client := &Client{
+		ID:     uuid.New(),
 		UserID: userID,
 		Conn:   conn,
-		SendCh: make(chan interface{}),
 		log:    logging.GetLogger(),
+		cfg:    cfg.withDefaults(),
+		inbox:  inbox,
+		codec:  codecFor(conn.Subprotocol()),
+		done:   make(chan struct{}),
+
+		inflight: make(map[string]*inflightPush),
+		attempts: make(map[uuid.UUID]int),
+		reauthed: make(chan struct{}, 1),
+		draining: make(chan struct{}),
+
+		attemptsReady: make(chan struct{}, 1),
 	}
+	client.SendCh = make(chan Envelope, client.cfg.SendQueueSize)
 	return client
 }
 
+func (c *Client) Key() uuid.UUID   { return c.ID }
+func (c *Client) Owner() uuid.UUID { return c.UserID }
+
+func (c *Client) currentClaims() *auth.Claims {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.claims
+}
+
 func (c *Client) ReadPump() {
 	defer func() {
-		Unregister(c.UserID)
+		Unregister(c)
+		c.closeOnce.Do(func() { close(c.done) })
 		err := c.Conn.Close()
 		if err != nil {
 			c.log.Errorf("user %s disconnected: %v", c.UserID, err)
@@ -36,12 +87,28 @@ func (c *Client) ReadPump() {
 		}
 	}()
 
+	c.Conn.SetReadLimit(c.cfg.MaxMessageSize)
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.cfg.PongWait)); err != nil {
+		c.log.Errorf("user %s disconnected: %v", c.UserID, err)
+		return
+	}
+	c.Conn.SetPongHandler(func(string) error {
+		return c.Conn.SetReadDeadline(time.Now().Add(c.cfg.PongWait))
+	})
+
 	for {
-		_, _, err := c.Conn.ReadMessage()
+		_, data, err := c.Conn.ReadMessage()
 		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				metricDeadConnections.Add(1)
+				c.log.Warnf("user %s conn %s missed pong, evicting", c.UserID, c.ID)
+				break
+			}
 			c.log.Errorf("user %s disconnected: %v", c.UserID, err)
 			break
 		}
+		c.handleFrame(data)
 	}
 }
 
@@ -52,28 +119,205 @@ func (c *Client) WritePump() {
 			c.log.Errorf("user %s disconnected: %v", c.UserID, err)
 		}
 	}(c.Conn)
-	for msg := range c.SendCh {
-		err := c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-		if err != nil {
-			c.log.Errorf("user %s disconnected: %v", c.UserID, err)
+	ticker := time.NewTicker(c.cfg.PingInterval)
+	defer ticker.Stop()
+	ackTicker := time.NewTicker(c.cfg.AckTimeout)
+	defer ackTicker.Stop()
+
+	for {
+		var msg Envelope
+		select {
+		case msg = <-c.SendCh:
+		case <-ticker.C:
+			if err := c.Conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(defaultWriteWait)); err != nil {
+				c.log.Errorf("ping to user %s failed: %v", c.UserID, err)
+				return
+			}
+			continue
+		case <-ackTicker.C:
+			for _, env := range c.duePushes() {
+				metricRedeliveries.Add(1)
+				if err := c.write(c.track(env)); err != nil {
+					return
+				}
+			}
+			continue
+		case <-c.draining:
+			c.flushAndClose()
+			return
+		case <-c.done:
 			return
 		}
-		data, err := json.Marshal(msg)
-		if err != nil {
-			c.log.Errorf("error marshalling message: %v", err)
-			continue
+		// tell the client it missed messages so it can catch up from the
+		// persisted feed before handling what comes next
+		if dropped := c.takeDropped(); dropped > 0 {
+			notice, _ := NewEnvelope(EventResyncRequired, "", ResyncPayload{Dropped: dropped})
+			if err := c.write(notice); err != nil {
+				return
+			}
 		}
-		if err := c.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
-			c.log.Errorf("error writing websocket message: %v", err)
-			break
+		if err := c.write(c.track(msg)); err != nil {
+			return
 		}
 	}
 }
 
-func (c *Client) Send(msg interface{}) {
+// write encodes msg with the negotiated codec and sends it as a single frame;
+// marshalling errors are logged and swallowed so only connection errors end the pump.
+func (c *Client) write(msg Envelope) error {
+	err := c.Conn.SetWriteDeadline(time.Now().Add(defaultWriteWait))
+	if err != nil {
+		c.log.Errorf("user %s disconnected: %v", c.UserID, err)
+		return err
+	}
+	data, err := c.codec.Marshal(msg)
+	if err != nil {
+		c.log.Errorf("error marshalling message: %v", err)
+		return nil
+	}
+	if err := c.Conn.WriteMessage(c.codec.MessageType(), data); err != nil {
+		c.log.Errorf("error writing websocket message: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (c *Client) Send(msg Envelope) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closing {
+		return
+	}
+	if c.replaying {
+		c.hold(msg)
+		return
+	}
+	if msg.Type == EventNotificationDelivered {
+		if id, err := uuid.Parse(msg.ID); err == nil {
+			c.settleLocked(id)
+		}
+	}
+
 	select {
 	case c.SendCh <- msg:
 	default:
-		c.log.Warnf("client %s send channel full, dropping message", c.UserID)
+		c.overflow(msg)
+	}
+}
+
+// overflow applies the configured policy to a full send queue. Callers hold c.mu.
+func (c *Client) overflow(msg Envelope) {
+	metricDroppedMessages.Add(1)
+	switch c.cfg.OverflowPolicy {
+	case OverflowDropNewest:
+		c.dropped++
+		c.log.Warnf("client %s send queue full, dropping newest message", c.ID)
+	case OverflowDisconnect:
+		c.closing = true
+		c.log.Warnf("client %s send queue full, disconnecting slow consumer", c.ID)
+		go c.closeWith(websocket.CloseTryAgainLater, "slow consumer, reconnect with a resume cursor")
+	default:
+		select {
+		case <-c.SendCh:
+		default:
+		}
+		select {
+		case c.SendCh <- msg:
+		default:
+		}
+		c.dropped++
+		c.log.Warnf("client %s send queue full, dropping oldest message", c.ID)
+	}
+}
+
+// hold keeps msg for after the replay. pending is bounded by the send queue
+// size and applies the same overflow policy, so a long replay cannot buffer
+// an unbounded live stream. Callers hold c.mu.
+func (c *Client) hold(msg Envelope) {
+	if len(c.pending) < c.cfg.SendQueueSize {
+		c.pending = append(c.pending, msg)
+		return
+	}
+	metricDroppedMessages.Add(1)
+	switch c.cfg.OverflowPolicy {
+	case OverflowDropNewest:
+		c.dropped++
+		c.log.Warnf("client %s replay backlog full, dropping newest message", c.ID)
+	case OverflowDisconnect:
+		c.closing = true
+		c.pending = nil
+		c.log.Warnf("client %s replay backlog full, disconnecting slow consumer", c.ID)
+		go c.closeWith(websocket.CloseTryAgainLater, "slow consumer, reconnect with a resume cursor")
+	default:
+		copy(c.pending, c.pending[1:])
+		c.pending[len(c.pending)-1] = msg
+		c.dropped++
+		c.log.Warnf("client %s replay backlog full, dropping oldest message", c.ID)
+	}
+}
+
+func (c *Client) takeDropped() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dropped := c.dropped
+	c.dropped = 0
+	return dropped
+}
+
+// closeWith sends a close frame and tears the connection down; ReadPump then
+// unregisters the client.
+func (c *Client) closeWith(code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	if err := c.Conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(defaultWriteWait)); err != nil {
+		c.log.Warnf("close frame to user %s failed: %v", c.UserID, err)
+	}
+	_ = c.Conn.Close()
+}
+
+// drain stops accepting messages and has WritePump flush the queue and close
+// with CloseServiceRestart.
+func (c *Client) drain() {
+	c.mu.Lock()
+	c.closing = true
+	c.mu.Unlock()
+	c.drainOnce.Do(func() { close(c.draining) })
+}
+
+// flushAndClose writes what is still queued, sends the restart close frame and
+// gives the client a moment to answer it so ReadPump exits on a clean close.
+// Only WritePump calls it.
+func (c *Client) flushAndClose() {
+flush:
+	for {
+		select {
+		case msg := <-c.SendCh:
+			if err := c.write(c.track(msg)); err != nil {
+				return
+			}
+		default:
+			break flush
+		}
+	}
+	msg := websocket.FormatCloseMessage(websocket.CloseServiceRestart, drainReason)
+	if err := c.Conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(defaultWriteWait)); err != nil {
+		c.log.Warnf("close frame to user %s failed: %v", c.UserID, err)
+		return
+	}
+	timer := time.NewTimer(defaultWriteWait)
+	defer timer.Stop()
+	select {
+	case <-c.done:
+	case <-timer.C:
+	}
+}
+
+// deliver blocks until the writer accepts msg, reporting false once the
+// connection is gone.
+func (c *Client) deliver(msg Envelope) bool {
+	select {
+	case c.SendCh <- msg:
+		return true
+	case <-c.done:
+		return false
 	}
 }
@@ -0,0 +1,75 @@
+package ws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestHeartbeatDefaults(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		ping, pong         time.Duration
+		wantPing, wantPong time.Duration
+	}{
+		{"unset", 0, 0, defaultPingInterval, defaultPongWait},
+		{"configured", 10 * time.Second, 30 * time.Second, 10 * time.Second, 30 * time.Second},
+		{"ping not shorter than pong", 30 * time.Second, 30 * time.Second, 27 * time.Second, 30 * time.Second},
+		{"only pong wait", 0, 20 * time.Second, 18 * time.Second, 20 * time.Second},
+	} {
+		cfg := Config{PingInterval: tc.ping, PongWait: tc.pong}.withDefaults()
+		if cfg.PingInterval != tc.wantPing || cfg.PongWait != tc.wantPong {
+			t.Errorf("%s: ping %v pong %v, want %v and %v", tc.name, cfg.PingInterval, cfg.PongWait, tc.wantPing, tc.wantPong)
+		}
+	}
+}
+
+func TestHeartbeatEvictsSilentPeers(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		answers bool
+	}{
+		{"peer answering pings stays", true},
+		{"silent peer is evicted", false},
+	} {
+		user := uuid.New()
+		c, peer := newSocketClient(t, user, Config{PingInterval: 20 * time.Millisecond, PongWait: 100 * time.Millisecond})
+		if err := Register(c); err != nil {
+			t.Fatal(err)
+		}
+		if tc.answers {
+			// reading runs the default ping handler, which answers with a pong
+			go func() {
+				for {
+					if _, _, err := peer.ReadMessage(); err != nil {
+						return
+					}
+				}
+			}()
+		}
+		dead := metricDeadConnections.Value()
+		go c.WritePump()
+		go c.ReadPump()
+
+		select {
+		case <-c.done:
+			if tc.answers {
+				t.Errorf("%s: connection was closed", tc.name)
+			}
+		case <-time.After(500 * time.Millisecond):
+			if !tc.answers {
+				t.Errorf("%s: connection outlived its pong wait", tc.name)
+			}
+		}
+
+		hub.mu.RLock()
+		_, registered := hub.clients[user][c.ID]
+		hub.mu.RUnlock()
+		evicted := metricDeadConnections.Value() > dead
+		if registered != tc.answers || evicted == tc.answers {
+			t.Errorf("%s: registered=%v evicted=%v", tc.name, registered, evicted)
+		}
+		Unregister(c)
+	}
+}
@@ -0,0 +1,142 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+	"reflect"
+)
+
+// Subprotocols negotiating the frame encoding. Both carry the same envelope
+// schema; clients that negotiate neither get JSON text frames.
+const (
+	ProtocolJSON    = "notif.v1.json"
+	ProtocolMsgpack = "notif.v1.msgpack"
+)
+
+// Codec encodes envelopes into WebSocket frames.
+type Codec interface {
+	// MessageType is the frame type written, websocket.TextMessage or BinaryMessage
+	MessageType() int
+	Marshal(env Envelope) ([]byte, error)
+	Unmarshal(data []byte, env *Envelope) error
+}
+
+// codecFor picks the codec for the negotiated subprotocol.
+func codecFor(subprotocol string) Codec {
+	if subprotocol == ProtocolMsgpack {
+		return msgpackCodec{}
+	}
+	return jsonCodec{}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) MessageType() int { return websocket.TextMessage }
+
+func (jsonCodec) Marshal(env Envelope) ([]byte, error) { return json.Marshal(env) }
+
+func (jsonCodec) Unmarshal(data []byte, env *Envelope) error { return json.Unmarshal(data, env) }
+
+var msgpackHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{}
+	h.WriteExt = true
+	h.RawToString = true
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	return h
+}()
+
+// msgpackEnvelope mirrors Envelope with the payload as a native value, so a
+// msgpack client sees maps and numbers rather than embedded JSON text.
+type msgpackEnvelope struct {
+	V          int         `codec:"v"`
+	Type       string      `codec:"type"`
+	ID         string      `codec:"id,omitempty"`
+	DeliveryID string      `codec:"delivery_id,omitempty"`
+	Topic      string      `codec:"topic,omitempty"`
+	Cursor     string      `codec:"cursor,omitempty"`
+	Payload    interface{} `codec:"payload,omitempty"`
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) MessageType() int { return websocket.BinaryMessage }
+
+func (msgpackCodec) Marshal(env Envelope) ([]byte, error) {
+	wire := msgpackEnvelope{V: env.V, Type: env.Type, ID: env.ID, DeliveryID: env.DeliveryID, Topic: env.Topic, Cursor: env.Cursor}
+	if len(env.Payload) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(env.Payload))
+		dec.UseNumber()
+		var payload interface{}
+		if err := dec.Decode(&payload); err != nil {
+			return nil, err
+		}
+		wire.Payload = nativeNumbers(payload)
+	}
+	var out []byte
+	err := codec.NewEncoderBytes(&out, msgpackHandle).Encode(wire)
+	return out, err
+}
+
+func (msgpackCodec) Unmarshal(data []byte, env *Envelope) error {
+	var wire msgpackEnvelope
+	if err := codec.NewDecoderBytes(data, msgpackHandle).Decode(&wire); err != nil {
+		return err
+	}
+	*env = Envelope{V: wire.V, Type: wire.Type, ID: wire.ID, DeliveryID: wire.DeliveryID, Topic: wire.Topic, Cursor: wire.Cursor}
+	if wire.Payload != nil {
+		payload, err := json.Marshal(wire.Payload)
+		if err != nil {
+			return err
+		}
+		env.Payload = payload
+	}
+	return nil
+}
+
+// nativeNumbers turns json.Number leaves into int64 or float64 so they are
+// encoded as msgpack numbers instead of strings.
+func nativeNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = nativeNumbers(e)
+		}
+		return t
+	case []interface{}:
+		for i, e := range t {
+			t[i] = nativeNumbers(e)
+		}
+		return t
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	default:
+		return v
+	}
+}
+
+// withCodecProtocols appends the codec subprotocols the operator did not list,
+// keeping their preference order first. The upgrader picks the first server
+// protocol the client offers, so JSON goes ahead of msgpack unless the
+// operator ranks msgpack higher.
+func withCodecProtocols(protocols []string) []string {
+	out := append([]string(nil), protocols...)
+	for _, p := range []string{ProtocolJSON, ProtocolMsgpack} {
+		found := false
+		for _, have := range out {
+			if have == p {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,93 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		env  Envelope
+	}{
+		{"bare", Envelope{V: ProtocolVersion, Type: "pong"}},
+		{"notification", Envelope{V: ProtocolVersion, Type: "notification", ID: "n1", DeliveryID: "d1", Cursor: "eyJjIjoxfQ",
+			Payload: json.RawMessage(`{"count":3,"ratio":0.5,"tags":["a"],"nested":{"big":9007199254740993}}`)}},
+		{"topic", Envelope{V: ProtocolVersion, Type: "broadcast", Topic: "ops", Payload: json.RawMessage(`"maintenance"`)}},
+	} {
+		for _, c := range []Codec{jsonCodec{}, msgpackCodec{}} {
+			data, err := c.Marshal(tc.env)
+			if err != nil {
+				t.Fatalf("%s %T: marshal: %v", tc.name, c, err)
+			}
+			var got Envelope
+			if err := c.Unmarshal(data, &got); err != nil {
+				t.Fatalf("%s %T: unmarshal: %v", tc.name, c, err)
+			}
+			if !samePayload(t, got.Payload, tc.env.Payload) {
+				t.Errorf("%s %T: payload %s, want %s", tc.name, c, got.Payload, tc.env.Payload)
+			}
+			want := tc.env
+			got.Payload, want.Payload = nil, nil
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s %T: got %+v, want %+v", tc.name, c, got, want)
+			}
+		}
+	}
+}
+
+// samePayload compares JSON payloads by value, keeping integers exact
+func samePayload(t *testing.T, got, want json.RawMessage) bool {
+	t.Helper()
+	if len(want) == 0 {
+		return len(got) == 0
+	}
+	decode := func(raw json.RawMessage) interface{} {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			t.Fatalf("decode %s: %v", raw, err)
+		}
+		return v
+	}
+	return fmt.Sprint(decode(got)) == fmt.Sprint(decode(want))
+}
+
+func TestCodecFor(t *testing.T) {
+	for _, tc := range []struct {
+		subprotocol string
+		want        int
+	}{
+		{"", websocket.TextMessage},
+		{ProtocolJSON, websocket.TextMessage},
+		{ProtocolMsgpack, websocket.BinaryMessage},
+		{"access_token", websocket.TextMessage},
+	} {
+		if got := codecFor(tc.subprotocol).MessageType(); got != tc.want {
+			t.Errorf("%q: message type %d, want %d", tc.subprotocol, got, tc.want)
+		}
+	}
+}
+
+func TestWithCodecProtocols(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		configured []string
+		want       []string
+	}{
+		{"none configured", nil, []string{ProtocolJSON, ProtocolMsgpack}},
+		{"operator order first", []string{"custom"}, []string{"custom", ProtocolJSON, ProtocolMsgpack}},
+		{"operator prefers msgpack", []string{ProtocolMsgpack}, []string{ProtocolMsgpack, ProtocolJSON}},
+		{"both listed", []string{ProtocolMsgpack, ProtocolJSON}, []string{ProtocolMsgpack, ProtocolJSON}},
+	} {
+		if got := withCodecProtocols(tc.configured); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"notificationService/internal/model"
+	"time"
+)
+
+const commandTimeout = 5 * time.Second
+
+var (
+	errUnsupportedVersion = errors.New("unsupported protocol version")
+	errUnknownCommand     = errors.New("unknown command")
+	errBadPayload         = errors.New("malformed command payload")
+	errReplayInProgress   = errors.New("replay already in progress")
+)
+
+// handleFrame decodes one inbound frame and answers it with a result or
+// error envelope carrying the command's ID.
+func (c *Client) handleFrame(data []byte) {
+	var cmd Envelope
+	if err := c.codec.Unmarshal(data, &cmd); err != nil {
+		c.reply(EventError, "", ErrorPayload{Message: "malformed envelope"})
+		return
+	}
+	if cmd.V != 0 && cmd.V != ProtocolVersion {
+		c.reply(EventError, cmd.ID, ErrorPayload{Message: errUnsupportedVersion.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	result, err := c.handleCommand(ctx, cmd)
+	if err != nil {
+		c.reply(EventError, cmd.ID, ErrorPayload{Message: err.Error()})
+		return
+	}
+	if cmd.Type == CommandPing {
+		c.reply(EventPong, cmd.ID, nil)
+		return
+	}
+	c.reply(EventResult, cmd.ID, result)
+}
+
+func (c *Client) handleCommand(ctx context.Context, cmd Envelope) (interface{}, error) {
+	switch cmd.Type {
+	case CommandPing:
+		return nil, nil
+
+	case CommandMarkRead:
+		var p MarkReadCommand
+		if err := decodePayload(cmd.Payload, &p); err != nil || p.NotificationID == uuid.Nil {
+			return nil, errBadPayload
+		}
+		readAt, err := c.inbox.MarkNotificationAsRead(ctx, c.UserID, p.NotificationID)
+		if err != nil {
+			return nil, err
+		}
+		read := NotificationReadPayload{IDs: []uuid.UUID{p.NotificationID}, ReadAt: readAt}
+		SendEvent(c.UserID, EventNotificationRead, p.NotificationID.String(), read)
+		c.publishUnreadCount(ctx)
+		return read, nil
+
+	case CommandMarkAllRead:
+		var p MarkAllReadCommand
+		if err := decodePayload(cmd.Payload, &p); err != nil {
+			return nil, errBadPayload
+		}
+		filter := model.ReadAllFilter{Type: p.Type, Before: p.Before}
+		count, err := c.inbox.MarkAllNotificationsAsRead(ctx, c.UserID, filter)
+		if err != nil {
+			return nil, err
+		}
+		read := NotificationReadPayload{All: true, Type: p.Type, Before: p.Before, ReadAt: time.Now().UTC()}
+		if count > 0 {
+			SendEvent(c.UserID, EventNotificationRead, "", read)
+			c.publishUnreadCount(ctx)
+		}
+		return read, nil
+
+	case CommandAck:
+		var p AckCommand
+		if err := decodePayload(cmd.Payload, &p); err != nil || (p.DeliveryID == "" && p.NotificationID == uuid.Nil) {
+			return nil, errBadPayload
+		}
+		return nil, c.acknowledge(ctx, p)
+
+	case CommandSubscribe:
+		var p SubscribeCommand
+		if err := decodePayload(cmd.Payload, &p); err != nil {
+			return nil, errBadPayload
+		}
+		if len(p.Topics) > 0 {
+			if err := c.joinTopics(ctx, p.Topics); err != nil {
+				return nil, err
+			}
+		}
+		if p.Since != "" {
+			cursor, err := ParseResumeCursor(ctx, c.inbox, c.UserID, p.Since)
+			if err != nil {
+				return nil, err
+			}
+			if !c.startReplay(*cursor) {
+				return nil, errReplayInProgress
+			}
+		} else {
+			c.mu.Lock()
+			replaying := c.replaying
+			c.mu.Unlock()
+			// a replay in progress redelivers once its backlog is sent
+			if !replaying {
+				go c.redeliver(nil)
+			}
+		}
+		count, err := c.inbox.CountUnread(ctx, c.UserID)
+		if err != nil {
+			return nil, err
+		}
+		return SubscriptionPayload{Count: count, Topics: hub.Topics(c)}, nil
+
+	case CommandUnsubscribe:
+		var p UnsubscribeCommand
+		if err := decodePayload(cmd.Payload, &p); err != nil || len(p.Topics) == 0 {
+			return nil, errBadPayload
+		}
+		c.leaveTopics(p.Topics)
+		count, err := c.inbox.CountUnread(ctx, c.UserID)
+		if err != nil {
+			return nil, err
+		}
+		return SubscriptionPayload{Count: count, Topics: hub.Topics(c)}, nil
+
+	case CommandReauth:
+		var p ReauthCommand
+		if err := decodePayload(cmd.Payload, &p); err != nil || p.Token == "" {
+			return nil, errBadPayload
+		}
+		return c.reauthenticate(ctx, p.Token)
+
+	default:
+		return nil, errUnknownCommand
+	}
+}
+
+// publishUnreadCount refreshes the badge on all of the user's sockets.
+func (c *Client) publishUnreadCount(ctx context.Context) {
+	count, err := c.inbox.CountUnread(ctx, c.UserID)
+	if err != nil {
+		c.log.Errorf("unread count for user %s failed: %v", c.UserID, err)
+		return
+	}
+	SendEvent(c.UserID, EventUnreadCount, "", UnreadCountPayload{Count: count})
+}
+
+// startReplay switches a live client into replay mode, reporting false when a
+// replay is already running.
+func (c *Client) startReplay(cursor ResumeCursor) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.replaying {
+		return false
+	}
+	c.replaying = true
+	go c.replay(c.inbox, cursor)
+	return true
+}
+
+func (c *Client) reply(eventType, id string, payload interface{}) {
+	env, err := NewEnvelope(eventType, id, payload)
+	if err != nil {
+		c.log.Errorf("error marshalling %s reply: %v", eventType, err)
+		return
+	}
+	c.Send(env)
+}
+
+func decodePayload(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, v)
+}
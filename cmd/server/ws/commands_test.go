@@ -0,0 +1,192 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"notificationService/internal/model"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// commandInbox answers mark_read with a fixed stored time and records
+// which notifications were acknowledged
+type commandInbox struct {
+	stubInbox
+	readAt  time.Time
+	readErr error
+
+	mu        sync.Mutex
+	delivered []uuid.UUID
+}
+
+func (i *commandInbox) MarkNotificationAsRead(context.Context, uuid.UUID, uuid.UUID) (time.Time, error) {
+	return i.readAt, i.readErr
+}
+
+func (i *commandInbox) MarkNotificationDelivered(_ context.Context, _ uuid.UUID, id uuid.UUID) (bool, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.delivered = append(i.delivered, id)
+	return true, nil
+}
+
+func newCommandClient(user uuid.UUID, inbox InboxService) *Client {
+	c := newReplayClient(user, Config{})
+	c.inbox = inbox
+	c.replaying = false
+	return c
+}
+
+func command(commandType, payload string) Envelope {
+	env := Envelope{V: ProtocolVersion, Type: commandType, ID: "c1"}
+	if payload != "" {
+		env.Payload = json.RawMessage(payload)
+	}
+	return env
+}
+
+func TestHandleCommandMarkRead(t *testing.T) {
+	user := uuid.New()
+	id := uuid.New()
+	stored := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	dbDown := errors.New("connection refused")
+
+	for _, tc := range []struct {
+		name    string
+		payload string
+		readErr error
+		want    error
+	}{
+		{"no payload", "", nil, errBadPayload},
+		{"nil id", `{"notification_id":"00000000-0000-0000-0000-000000000000"}`, nil, errBadPayload},
+		{"malformed id", `{"notification_id":"nope"}`, nil, errBadPayload},
+		{"not found", `{"notification_id":"` + id.String() + `"}`, model.ErrNotFound, model.ErrNotFound},
+		{"store down", `{"notification_id":"` + id.String() + `"}`, dbDown, dbDown},
+		{"read", `{"notification_id":"` + id.String() + `"}`, nil, nil},
+	} {
+		c := newCommandClient(user, &commandInbox{readAt: stored, readErr: tc.readErr})
+		result, err := c.handleCommand(context.Background(), command(CommandMarkRead, tc.payload))
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+			continue
+		}
+		if tc.want != nil {
+			continue
+		}
+		read, ok := result.(NotificationReadPayload)
+		if !ok || len(read.IDs) != 1 || read.IDs[0] != id || !read.ReadAt.Equal(stored) {
+			t.Errorf("%s: got %+v, want %s read at the stored %v", tc.name, result, id, stored)
+		}
+	}
+}
+
+func TestHandleCommandAck(t *testing.T) {
+	user := uuid.New()
+	pushed := uuid.New()
+	direct := uuid.New()
+
+	for _, tc := range []struct {
+		name    string
+		payload string
+		want    error
+		acked   []uuid.UUID
+	}{
+		{"no payload", "", errBadPayload, nil},
+		{"empty ack", `{}`, errBadPayload, nil},
+		{"delivery id", `{"delivery_id":"d1"}`, nil, []uuid.UUID{pushed}},
+		{"settled delivery id", `{"delivery_id":"gone"}`, nil, nil},
+		{"notification id", `{"notification_id":"` + direct.String() + `"}`, nil, []uuid.UUID{direct}},
+	} {
+		inbox := &commandInbox{}
+		c := newCommandClient(user, inbox)
+		c.inflight["d1"] = &inflightPush{notificationID: pushed}
+
+		if _, err := c.handleCommand(context.Background(), command(CommandAck, tc.payload)); !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+			continue
+		}
+		if len(inbox.delivered) != len(tc.acked) || (len(tc.acked) == 1 && inbox.delivered[0] != tc.acked[0]) {
+			t.Errorf("%s: marked %v delivered, want %v", tc.name, inbox.delivered, tc.acked)
+		}
+		if len(tc.acked) == 1 && tc.acked[0] == pushed && c.isInflight(pushed) {
+			t.Errorf("%s: push is still in flight after its ack", tc.name)
+		}
+	}
+}
+
+func TestHandleCommandSubscribe(t *testing.T) {
+	user := uuid.New()
+	feed := newSliceFeed(user, 3)
+	undelivered := feed[2:]
+
+	for _, tc := range []struct {
+		name      string
+		payload   string
+		replaying bool
+		want      error
+		replays   bool
+		resends   bool
+	}{
+		{"malformed payload", `{"since":5}`, false, errBadPayload, false, false},
+		{"invalid topic", `{"topics":["no spaces allowed"]}`, false, ErrInvalidTopic, false, false},
+		{"unknown cursor", `{"since":"` + uuid.NewString() + `"}`, false, ErrInvalidCursor, false, false},
+		{"since a notification", `{"since":"` + feed[0].ID.String() + `"}`, false, nil, true, true},
+		{"since during a replay", `{"since":"` + feed[0].ID.String() + `"}`, true, errReplayInProgress, false, false},
+		{"no since redelivers", `{}`, false, nil, false, true},
+		{"no since during a replay", `{}`, true, nil, false, false},
+	} {
+		c := newCommandClient(user, stubInbox{sliceFeed: feed, undelivered: undelivered})
+		c.replaying = tc.replaying
+
+		result, err := c.handleCommand(context.Background(), command(CommandSubscribe, tc.payload))
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+			continue
+		}
+		if tc.want != nil {
+			continue
+		}
+		if _, ok := result.(SubscriptionPayload); !ok {
+			t.Errorf("%s: got %T, want SubscriptionPayload", tc.name, result)
+		}
+
+		var want []string
+		if tc.replays {
+			want = append(want, feed[1].ID.String(), feed[2].ID.String())
+		} else if tc.resends {
+			want = append(want, undelivered[0].ID.String())
+		}
+		got := waitIDs(c, len(want))
+		if len(got) != len(want) {
+			t.Errorf("%s: sent %v, want %v", tc.name, got, want)
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: sent %v, want %v", tc.name, got, want)
+				break
+			}
+		}
+	}
+}
+
+// waitIDs collects n envelope IDs from the send queue, then anything else
+// that arrives shortly after
+func waitIDs(c *Client, n int) []string {
+	var ids []string
+	timeout := time.After(time.Second)
+	for len(ids) < n {
+		select {
+		case env := <-c.SendCh:
+			ids = append(ids, env.ID)
+		case <-timeout:
+			return ids
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	return append(ids, drainIDs(c)...)
+}
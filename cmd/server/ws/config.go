@@ -0,0 +1,141 @@
+package ws
+
+import "time"
+
+const (
+	defaultPingInterval   = 54 * time.Second
+	defaultPongWait       = 60 * time.Second
+	defaultWriteWait      = 10 * time.Second
+	defaultMaxMessageSize = 4096
+	defaultSendQueueSize  = 64
+
+	defaultAckTimeout          = 15 * time.Second
+	defaultMaxDeliveryAttempts = 5
+	defaultDeliveryRetryWindow = 24 * time.Hour
+
+	defaultTicketTTL  = 30 * time.Second
+	defaultReauthLead = time.Minute
+
+	defaultMaxConnectionsPerUser = 10
+	defaultHandshakeRateLimit    = 30
+	defaultHandshakeRateWindow   = time.Minute
+
+	defaultPresenceGrant = "notifications:presence"
+)
+
+// OverflowPolicy decides what happens when a client's send queue is full.
+type OverflowPolicy string
+
+const (
+	// OverflowDropOldest discards the oldest queued message to make room
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+	// OverflowDropNewest discards the message being sent
+	OverflowDropNewest OverflowPolicy = "drop-newest"
+	// OverflowDisconnect closes the connection so the client reconnects with a resume cursor
+	OverflowDisconnect OverflowPolicy = "disconnect"
+)
+
+// Config tunes socket behaviour. Zero values fall back to defaults.
+type Config struct {
+	// PingInterval is how often the server pings; it must be shorter than PongWait
+	PingInterval time.Duration
+	// PongWait is how long a client may stay silent before it is considered dead
+	PongWait time.Duration
+	// MaxMessageSize caps inbound frames in bytes
+	MaxMessageSize int64
+	// SendQueueSize bounds the number of messages queued per connection
+	SendQueueSize int
+	// OverflowPolicy applies once the send queue is full; dropped messages
+	// stay recoverable from the persisted feed
+	OverflowPolicy OverflowPolicy
+
+	// AckTimeout is how long a push may stay unacknowledged before it is resent
+	AckTimeout time.Duration
+	// MaxDeliveryAttempts caps pushes of one notification, per connection and
+	// across reconnects
+	MaxDeliveryAttempts int
+	// DeliveryRetryWindow limits which unacknowledged notifications are resent
+	// when a user connects
+	DeliveryRetryWindow time.Duration
+
+	// AllowedOrigins lists browser origins allowed to open sockets; empty
+	// means same-origin only. See originChecker for the accepted patterns.
+	AllowedOrigins []string
+	// ReadBufferSize and WriteBufferSize size the handshake I/O buffers;
+	// zero keeps gorilla's defaults
+	ReadBufferSize  int
+	WriteBufferSize int
+	// EnableCompression negotiates permessage-deflate with clients that offer it
+	EnableCompression bool
+	// Subprotocols are offered in server preference order
+	Subprotocols []string
+
+	// TicketTTL is how long a handshake ticket stays redeemable
+	TicketTTL time.Duration
+	// ReauthLead is how long before token expiry a socket is asked to re-authenticate
+	ReauthLead time.Duration
+
+	// MaxConnectionsPerUser caps one user's open sockets and streams on each
+	// instance; replicas do not share the count, so the cluster-wide limit
+	// is this times the number of replicas. Negative disables the cap
+	MaxConnectionsPerUser int
+	// HandshakeRateLimit is how many handshakes one client IP may attempt per
+	// HandshakeRateWindow, counted across all instances
+	HandshakeRateLimit  int
+	HandshakeRateWindow time.Duration
+
+	// PresenceGrant is the role or scope a service account needs to query
+	// presence; user tokens are always refused
+	PresenceGrant string
+}
+
+func (c Config) withDefaults() Config {
+	if c.PongWait <= 0 {
+		c.PongWait = defaultPongWait
+	}
+	if c.PingInterval <= 0 {
+		c.PingInterval = defaultPingInterval
+	}
+	if c.PingInterval >= c.PongWait {
+		c.PingInterval = c.PongWait * 9 / 10
+	}
+	if c.MaxMessageSize <= 0 {
+		c.MaxMessageSize = defaultMaxMessageSize
+	}
+	if c.SendQueueSize <= 0 {
+		c.SendQueueSize = defaultSendQueueSize
+	}
+	if c.AckTimeout <= 0 {
+		c.AckTimeout = defaultAckTimeout
+	}
+	if c.MaxDeliveryAttempts <= 0 {
+		c.MaxDeliveryAttempts = defaultMaxDeliveryAttempts
+	}
+	if c.DeliveryRetryWindow <= 0 {
+		c.DeliveryRetryWindow = defaultDeliveryRetryWindow
+	}
+	if c.TicketTTL <= 0 {
+		c.TicketTTL = defaultTicketTTL
+	}
+	if c.ReauthLead <= 0 {
+		c.ReauthLead = defaultReauthLead
+	}
+	if c.MaxConnectionsPerUser == 0 {
+		c.MaxConnectionsPerUser = defaultMaxConnectionsPerUser
+	}
+	if c.HandshakeRateLimit <= 0 {
+		c.HandshakeRateLimit = defaultHandshakeRateLimit
+	}
+	if c.HandshakeRateWindow <= 0 {
+		c.HandshakeRateWindow = defaultHandshakeRateWindow
+	}
+	if c.PresenceGrant == "" {
+		c.PresenceGrant = defaultPresenceGrant
+	}
+	switch c.OverflowPolicy {
+	case OverflowDropOldest, OverflowDropNewest, OverflowDisconnect:
+	default:
+		c.OverflowPolicy = OverflowDropOldest
+	}
+	return c
+}
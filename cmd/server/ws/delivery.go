@@ -0,0 +1,193 @@
+package ws
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"time"
+)
+
+// inflightPush is a notification written to the socket but not acknowledged yet.
+type inflightPush struct {
+	notificationID uuid.UUID
+	env            Envelope
+	attempts       int
+	sentAt         time.Time
+}
+
+// track stamps a delivery ID on the first write of a notification and counts
+// every attempt. Only WritePump calls it.
+func (c *Client) track(env Envelope) Envelope {
+	if env.Type != EventNotificationCreated {
+		return env
+	}
+	notificationID, err := uuid.Parse(env.ID)
+	if err != nil {
+		return env
+	}
+
+	c.mu.Lock()
+	if env.DeliveryID == "" {
+		env.DeliveryID = uuid.NewString()
+	}
+	push, ok := c.inflight[env.DeliveryID]
+	if !ok {
+		push = &inflightPush{notificationID: notificationID, env: env}
+		c.inflight[env.DeliveryID] = push
+	}
+	push.attempts++
+	push.sentAt = time.Now()
+	c.attempts[notificationID]++
+	c.mu.Unlock()
+
+	select {
+	case c.attemptsReady <- struct{}{}:
+	default:
+	}
+	return env
+}
+
+// duePushes returns the pushes whose ack timed out and abandons those that
+// ran out of attempts; they are retried on the next connection instead.
+func (c *Client) duePushes() []Envelope {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var due []Envelope
+	for deliveryID, push := range c.inflight {
+		if now.Sub(push.sentAt) < c.cfg.AckTimeout {
+			continue
+		}
+		if push.attempts >= c.cfg.MaxDeliveryAttempts {
+			delete(c.inflight, deliveryID)
+			metricUndelivered.Add(1)
+			c.log.Warnf("notification %s to user %s unacknowledged after %d attempts", push.notificationID, c.UserID, push.attempts)
+			continue
+		}
+		due = append(due, push.env)
+	}
+	return due
+}
+
+// acknowledge settles a push and stores delivered_at; the first ack for a
+// notification is announced to the user's other sockets so they stop retrying.
+func (c *Client) acknowledge(ctx context.Context, ack AckCommand) error {
+	notificationID := ack.NotificationID
+	if ack.DeliveryID != "" {
+		c.mu.Lock()
+		if push, ok := c.inflight[ack.DeliveryID]; ok {
+			notificationID = push.notificationID
+		}
+		c.mu.Unlock()
+	}
+	if notificationID == uuid.Nil {
+		// unknown delivery ID: already settled or abandoned
+		return nil
+	}
+
+	c.mu.Lock()
+	c.settleLocked(notificationID)
+	c.mu.Unlock()
+
+	first, err := c.inbox.MarkNotificationDelivered(ctx, c.UserID, notificationID)
+	if err != nil {
+		return err
+	}
+	if first {
+		SendEvent(c.UserID, EventNotificationDelivered, notificationID.String(), DeliveredPayload{
+			NotificationID: notificationID,
+			DeliveredAt:    time.Now().UTC(),
+		})
+	}
+	return nil
+}
+
+// settleLocked forgets every in-flight push of a notification. Callers hold c.mu.
+func (c *Client) settleLocked(notificationID uuid.UUID) {
+	for deliveryID, push := range c.inflight {
+		if push.notificationID == notificationID {
+			delete(c.inflight, deliveryID)
+		}
+	}
+}
+
+// redeliver pushes notifications that were never acknowledged on an earlier
+// connection, within the retry window and attempt limit. It runs on every
+// (re)subscribe, so it skips notifications in seen, which it extends with
+// what it sends, and those already in flight on this connection. It reports
+// false once the client is gone.
+func (c *Client) redeliver(seen map[uuid.UUID]struct{}) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	since := time.Now().Add(-c.cfg.DeliveryRetryWindow)
+	pending, err := c.inbox.GetUndeliveredNotifications(ctx, c.UserID, since, c.cfg.MaxDeliveryAttempts, replayPageSize)
+	if err != nil {
+		c.log.Errorf("loading undelivered notifications for user %s failed: %v", c.UserID, err)
+		return true
+	}
+	for i := range pending {
+		n := &pending[i]
+		if _, ok := seen[n.ID]; ok || c.isInflight(n.ID) {
+			continue
+		}
+		env, err := notificationEnvelope(n)
+		if err != nil {
+			c.log.Errorf("error marshalling notification %s: %v", n.ID, err)
+			continue
+		}
+		metricRedeliveries.Add(1)
+		if !c.deliver(env) {
+			return false
+		}
+		if seen != nil {
+			seen[n.ID] = struct{}{}
+		}
+	}
+	return true
+}
+
+func (c *Client) isInflight(notificationID uuid.UUID) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, push := range c.inflight {
+		if push.notificationID == notificationID {
+			return true
+		}
+	}
+	return false
+}
+
+// recordAttempts persists push counts in the background, one batched write
+// at a time, so WritePump never waits on the database and a burst of pushes
+// costs a single UPDATE. Counts still unsaved when the client goes away are
+// flushed before it returns.
+func (c *Client) recordAttempts() {
+	for {
+		select {
+		case <-c.attemptsReady:
+			c.flushAttempts()
+		case <-c.done:
+			c.flushAttempts()
+			return
+		}
+	}
+}
+
+func (c *Client) flushAttempts() {
+	c.mu.Lock()
+	attempts := c.attempts
+	if len(attempts) > 0 {
+		c.attempts = make(map[uuid.UUID]int)
+	}
+	c.mu.Unlock()
+	if len(attempts) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	if err := c.inbox.RecordDeliveryAttempts(ctx, c.UserID, attempts); err != nil {
+		c.log.Errorf("recording %d delivery attempts for user %s failed: %v", len(attempts), c.UserID, err)
+	}
+}
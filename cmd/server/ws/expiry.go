@@ -0,0 +1,86 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/websocket"
+	"time"
+)
+
+var errReauthMismatch = errors.New("token belongs to a different user")
+
+// watchExpiry warns the client ReauthLead before its token expires and closes
+// the socket once it does, unless a reauth command extends the session.
+func (c *Client) watchExpiry() {
+	for {
+		c.mu.Lock()
+		expiresAt := c.expiresAt
+		c.mu.Unlock()
+		if expiresAt.IsZero() {
+			return
+		}
+
+		if !c.waitUntil(expiresAt.Add(-c.cfg.ReauthLead)) {
+			continue
+		}
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+		c.reply(EventReauthRequired, "", ReauthRequiredPayload{ExpiresAt: expiresAt})
+
+		if !c.waitUntil(expiresAt) {
+			continue
+		}
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+		metricExpiredSessions.Add(1)
+		c.log.Infof("user %s conn %s token expired, closing", c.UserID, c.ID)
+		c.closeWith(websocket.ClosePolicyViolation, "token expired")
+		return
+	}
+}
+
+// waitUntil sleeps until t, returning false early when the session was
+// re-authenticated; it also returns true once the client is gone.
+func (c *Client) waitUntil(t time.Time) bool {
+	timer := time.NewTimer(max(time.Until(t), 0))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-c.reauthed:
+		return false
+	case <-c.done:
+		return true
+	}
+}
+
+// reauthenticate swaps in a refreshed token for the same user and pushes the
+// session expiry out accordingly.
+func (c *Client) reauthenticate(_ context.Context, token string) (*ReauthRequiredPayload, error) {
+	if c.verifier == nil {
+		return nil, errUnknownCommand
+	}
+	claims, err := c.verifier.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.UserID != c.UserID {
+		return nil, errReauthMismatch
+	}
+
+	c.mu.Lock()
+	c.expiresAt = claims.ExpiresAt
+	c.claims = claims
+	c.mu.Unlock()
+	select {
+	case c.reauthed <- struct{}{}:
+	default:
+	}
+	return &ReauthRequiredPayload{ExpiresAt: claims.ExpiresAt}, nil
+}
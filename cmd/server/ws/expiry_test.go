@@ -0,0 +1,162 @@
+package ws
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"notificationService/internal/auth"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// newTestVerifier serves a one-key JWKS and returns a verifier trusting it
+// along with a signer for access tokens of that key
+func newTestVerifier(t *testing.T) (*auth.Verifier, func(user uuid.UUID, exp time.Time) string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA", "kid": "test", "alg": "RS256", "use": "sig",
+		"n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write(jwks) }))
+	t.Cleanup(srv.Close)
+
+	verifier, err := auth.NewVerifier(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(user uuid.UUID, exp time.Time) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": user.String(), "exp": exp.Unix()})
+		token.Header["kid"] = "test"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	return verifier, sign
+}
+
+// newSocketClient upgrades a loopback connection and returns the server-side
+// client along with the dialled end
+func newSocketClient(t *testing.T, user uuid.UUID, cfg Config) (*Client, *websocket.Conn) {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = peer.Close() })
+	c := NewClient(user, <-conns, cfg, stubInbox{})
+	t.Cleanup(func() {
+		c.closeOnce.Do(func() { close(c.done) })
+		_ = c.Conn.Close()
+	})
+	return c, peer
+}
+
+func TestReauthenticate(t *testing.T) {
+	verifier, sign := newTestVerifier(t)
+	user := uuid.New()
+	extended := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+
+	for _, tc := range []struct {
+		name     string
+		verifier *auth.Verifier
+		token    string
+		want     error
+	}{
+		{"no verifier", nil, sign(user, extended), errUnknownCommand},
+		{"garbage token", verifier, "not.a.token", auth.ErrInvalidToken},
+		{"expired token", verifier, sign(user, time.Now().Add(-time.Minute)), auth.ErrInvalidToken},
+		{"another user", verifier, sign(uuid.New(), extended), errReauthMismatch},
+		{"same user", verifier, sign(user, extended), nil},
+	} {
+		c := newReplayClient(user, Config{})
+		c.verifier = tc.verifier
+		c.reauthed = make(chan struct{}, 1)
+		c.expiresAt = time.Now().Add(time.Minute)
+
+		reply, err := c.reauthenticate(context.Background(), tc.token)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+			continue
+		}
+		if tc.want != nil {
+			if len(c.reauthed) != 0 {
+				t.Errorf("%s: a refused reauth woke the expiry watcher", tc.name)
+			}
+			continue
+		}
+		if !reply.ExpiresAt.Equal(extended) || !c.expiresAt.Equal(extended) || c.currentClaims().UserID != user {
+			t.Errorf("%s: reply %v, session expires %v, want both %v", tc.name, reply.ExpiresAt, c.expiresAt, extended)
+		}
+		if len(c.reauthed) != 1 {
+			t.Errorf("%s: expiry watcher was not woken", tc.name)
+		}
+	}
+}
+
+func TestWatchExpiry(t *testing.T) {
+	verifier, sign := newTestVerifier(t)
+
+	t.Run("closes once the token expires", func(t *testing.T) {
+		user := uuid.New()
+		c, peer := newSocketClient(t, user, Config{ReauthLead: time.Hour})
+		c.expiresAt = time.Now().Add(200 * time.Millisecond)
+		go c.watchExpiry()
+
+		if env := <-c.SendCh; env.Type != EventReauthRequired {
+			t.Fatalf("got %s, want %s", env.Type, EventReauthRequired)
+		}
+		_ = peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, _, err := peer.ReadMessage()
+		if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+			t.Fatalf("got %v, want a policy violation close", err)
+		}
+	})
+
+	t.Run("reauth extends the session", func(t *testing.T) {
+		user := uuid.New()
+		c, peer := newSocketClient(t, user, Config{ReauthLead: time.Hour})
+		c.verifier = verifier
+		c.expiresAt = time.Now().Add(300 * time.Millisecond)
+		go c.watchExpiry()
+
+		if env := <-c.SendCh; env.Type != EventReauthRequired {
+			t.Fatalf("got %s, want %s", env.Type, EventReauthRequired)
+		}
+		if _, err := c.reauthenticate(context.Background(), sign(user, time.Now().Add(3*time.Hour))); err != nil {
+			t.Fatal(err)
+		}
+		_ = peer.SetReadDeadline(time.Now().Add(time.Second))
+		if _, _, err := peer.ReadMessage(); websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+			t.Fatal("session closed after a successful reauth")
+		}
+	})
+}
@@ -1,38 +1,122 @@
 package ws
 
 import (
-	"github.com/Sayan80bayev/go-project/pkg/middleware"
+	"errors"
+	"fmt"
+	"github.com/Sayan80bayev/go-project/pkg/logging"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"net/http"
+	"notificationService/internal/auth"
+	"strconv"
+	"time"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
-}
+// HandleWebSocket upgrades the connection and, when the client passes a
+// `since` cursor, replays missed notifications from the inbox before going live.
+func HandleWebSocket(inbox InboxService, verifier *auth.Verifier, cfg Config) gin.HandlerFunc {
+	upgrader := newUpgrader(cfg)
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user_id missing in context"})
+			return
+		}
+		uid := userID.(uuid.UUID)
 
-func HandleWebSocket(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "user_id missing in context"})
-		return
-	}
-	uid := userID.(uuid.UUID)
+		var cursor *ResumeCursor
+		if since := c.Query("since"); since != "" {
+			parsed, err := ParseResumeCursor(c, inbox, uid, since)
+			if err != nil {
+				if errors.Is(err, ErrInvalidCursor) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			cursor = parsed
+		}
+
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			// the upgrader has already replied and logged the failure
+			return
+		}
 
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to upgrade websocket"})
-		return
+		client := NewClient(uid, conn, cfg, inbox)
+		client.verifier = verifier
+		if claims, ok := c.Get("claims"); ok {
+			client.claims = claims.(*auth.Claims)
+			client.expiresAt = client.claims.ExpiresAt
+		}
+		// hold live messages from the moment the client is registered so
+		// nothing slips between the replay query and live delivery
+		client.replaying = cursor != nil
+		if err := RegisterLimited(client, cfg.MaxConnectionsPerUser); err != nil {
+			if errors.Is(err, errDraining) {
+				rejectSocket(conn, websocket.CloseServiceRestart, drainReason)
+				return
+			}
+			metricConnectionLimited.Add(1)
+			rejectSocket(conn, websocket.ClosePolicyViolation, fmt.Sprintf("connection limit reached (max %d per user)", cfg.MaxConnectionsPerUser))
+			return
+		}
+
+		go client.WritePump()
+		go client.ReadPump()
+		go client.watchExpiry()
+		go client.recordAttempts()
+		if cursor != nil {
+			go client.replay(inbox, *cursor)
+		} else {
+			go client.redeliver(nil)
+		}
 	}
+}
 
-	client := NewClient(uid, conn)
-	Register(client)
+// LimitHandshakes rejects clients whose IP exceeds the handshake rate. Socket
+// upgrades are accepted and closed with a reason; other requests get a 429.
+// A nil limiter disables the check, and limiter errors let the request through.
+func LimitHandshakes(limiter RateLimiter, cfg Config) gin.HandlerFunc {
+	upgrader := newUpgrader(cfg)
+	return func(c *gin.Context) {
+		if limiter == nil {
+			c.Next()
+			return
+		}
+		// ClientIP only honours forwarding headers from the configured trusted proxies
+		allowed, retryAfter, err := limiter.Allow(c.Request.Context(), "ip:"+c.ClientIP())
+		if err != nil {
+			logging.GetLogger().Errorf("handshake rate limit check failed: %v", err)
+		}
+		if allowed || err != nil {
+			c.Next()
+			return
+		}
 
-	go client.WritePump()
-	go client.ReadPump()
+		metricRateLimited.Add(1)
+		if websocket.IsWebSocketUpgrade(c.Request) {
+			conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+			c.Abort()
+			if err == nil {
+				rejectSocket(conn, websocket.CloseTryAgainLater, retryReason(retryAfter))
+			}
+			return
+		}
+		c.Header("Retry-After", strconv.Itoa(int(retryAfter.Round(time.Second).Seconds())))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "too many connection attempts"})
+	}
 }
 
-func SetupWebSocketRoutes(r *gin.Engine, JWKSUrl string) {
-	r.GET("/ws", middleware.AuthMiddleware(JWKSUrl), HandleWebSocket)
+func SetupWebSocketRoutes(r *gin.Engine, verifier *auth.Verifier, tickets TicketStore, limiter RateLimiter, inbox InboxService, cfg Config) {
+	cfg = cfg.withDefaults()
+	authn := auth.Authenticate(verifier, handshakeCredentials(verifier, tickets))
+	limit := LimitHandshakes(limiter, cfg)
+	r.POST("/ws/ticket", auth.Authenticate(verifier), HandleIssueTicket(tickets, cfg.TicketTTL))
+	r.GET("/ws", limit, authn, HandleWebSocket(inbox, verifier, cfg))
+	r.GET("/events", limit, authn, HandleSSE(inbox, cfg))
+	r.GET("/poll", authn, HandlePoll(inbox))
+	r.GET("/presence", auth.Authenticate(verifier), auth.RequireServiceAccount(cfg.PresenceGrant), HandlePresence())
 }
@@ -1,44 +1,450 @@
 package ws
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"github.com/Sayan80bayev/go-project/pkg/logging"
 	"github.com/google/uuid"
+	"notificationService/internal/model"
+	"sort"
+	"strings"
 	"sync"
 )
 
+// Subscriber is a live connection the hub fans events out to: a WebSocket
+// client or an SSE stream.
+type Subscriber interface {
+	// Key identifies the connection
+	Key() uuid.UUID
+	// Owner is the user the connection belongs to
+	Owner() uuid.UUID
+	Send(env Envelope)
+}
+
+var (
+	errConnectionLimit = errors.New("connection limit reached")
+	errDraining        = errors.New("server is shutting down")
+	errNotConnected    = errors.New("connection is closed")
+	errTooManyTopics   = errors.New("topic limit reached")
+)
+
+// maxTopicsPerConnection bounds how many topics one socket may join.
+const maxTopicsPerConnection = 50
+
+// drainReason is sent with CloseServiceRestart when the instance shuts down.
+const drainReason = "server restarting, reconnect"
+
+// drainer is implemented by subscribers that can end themselves cleanly when
+// the instance shuts down.
+type drainer interface {
+	drain()
+}
+
+// transient is implemented by subscribers that only wait briefly, such as
+// long-poll requests; they do not make their user count as present.
+type transient interface {
+	transient()
+}
+
+// Hub keeps every live connection grouped by user, so a user with several
+// tabs or devices open receives each notification on all of them. Outgoing
+// messages travel through the backplane so that sockets held by other
+// instances receive them too.
 type Hub struct {
-	clients map[uuid.UUID]*Client
-	mu      sync.RWMutex
+	clients   map[uuid.UUID]map[uuid.UUID]Subscriber
+	mu        sync.RWMutex
+	backplane Backplane
+	// present counts each user's non-transient connections for presence
+	present  map[uuid.UUID]int
+	presence *Presence
+	// once draining, registrations are refused and drained is closed when
+	// the last connection unregisters
+	draining bool
+	drained  chan struct{}
+	// topics maps a topic to its local members by connection key; joined is
+	// the reverse index used to leave everything when a connection goes away
+	topics    map[string]map[uuid.UUID]Subscriber
+	joined    map[uuid.UUID]map[string]struct{}
+	topicAuth TopicAuthorizer
+	// channels tracks backplane subscriptions, which are changed after
+	// h.mu is released so a slow backplane never stalls the hub
+	channels *channelRefs
 }
 
-var hub = &Hub{
-	clients: make(map[uuid.UUID]*Client),
+var hub = newHub(NewMemoryBackplane())
+
+func newHub(b Backplane) *Hub {
+	h := &Hub{
+		clients:   make(map[uuid.UUID]map[uuid.UUID]Subscriber),
+		backplane: b,
+		present:   make(map[uuid.UUID]int),
+		topics:    make(map[string]map[uuid.UUID]Subscriber),
+		joined:    make(map[uuid.UUID]map[string]struct{}),
+		channels:  newChannelRefs(),
+	}
+	b.Start(context.Background(), h.deliverLocal)
+	h.subscribeBroadcast()
+	return h
 }
 
-func (h *Hub) Register(client *Client) {
+func (h *Hub) subscribeBroadcast() {
+	h.mu.RLock()
+	b := h.backplane
+	h.mu.RUnlock()
+	if err := b.Subscribe(context.Background(), broadcastChannel); err != nil {
+		logging.GetLogger().Errorf("backplane subscribe for broadcasts failed: %v", err)
+	}
+}
+
+func (h *Hub) Register(s Subscriber) error {
+	return h.TryRegister(s, 0)
+}
+
+// TryRegister registers s unless its user already holds max connections on
+// this instance or the hub is draining; max <= 0 means no limit.
+func (h *Hub) TryRegister(s Subscriber, max int) error {
+	b, err := h.register(s, max)
+	if err != nil {
+		return err
+	}
+	// the user channel is subscribed before TryRegister returns, so the
+	// caller does not miss messages published after that
+	h.channels.acquire(b, userChannel(s.Owner()))
+	return nil
+}
+
+func (h *Hub) register(s Subscriber, max int) (Backplane, error) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	h.clients[client.UserID] = client
+	if h.draining {
+		return nil, errDraining
+	}
+	if max > 0 && len(h.clients[s.Owner()]) >= max {
+		return nil, errConnectionLimit
+	}
+	conns, ok := h.clients[s.Owner()]
+	if !ok {
+		conns = make(map[uuid.UUID]Subscriber)
+		h.clients[s.Owner()] = conns
+	}
+	conns[s.Key()] = s
+	metricActiveConnections.Add(1)
+	if _, ok := s.(transient); !ok {
+		h.present[s.Owner()]++
+		if h.present[s.Owner()] == 1 && h.presence != nil {
+			h.presence.connected(s.Owner())
+		}
+	}
+	return h.backplane, nil
 }
 
-func (h *Hub) Unregister(userID uuid.UUID) {
+// Unregister removes a single connection and drops the user entry once
+// their last connection is gone.
+func (h *Hub) Unregister(s Subscriber) {
+	b, topics, ok := h.unregister(s)
+	if !ok {
+		return
+	}
+	for _, topic := range topics {
+		h.channels.release(b, topicChannel(topic))
+	}
+	h.channels.release(b, userChannel(s.Owner()))
+}
+
+// unregister updates the maps and returns the topics the connection left.
+func (h *Hub) unregister(s Subscriber) (Backplane, []string, bool) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	delete(h.clients, userID)
+	conns, ok := h.clients[s.Owner()]
+	if !ok {
+		return nil, nil, false
+	}
+	if _, ok := conns[s.Key()]; !ok {
+		return nil, nil, false
+	}
+	delete(conns, s.Key())
+	metricActiveConnections.Add(-1)
+	var topics []string
+	for topic := range h.joined[s.Key()] {
+		h.leaveLocked(s.Key(), topic)
+		topics = append(topics, topic)
+	}
+	if _, ok := s.(transient); !ok {
+		h.present[s.Owner()]--
+		if h.present[s.Owner()] <= 0 {
+			delete(h.present, s.Owner())
+			if h.presence != nil {
+				h.presence.disconnected(s.Owner())
+			}
+		}
+	}
+	if len(conns) == 0 {
+		delete(h.clients, s.Owner())
+		if h.draining && len(h.clients) == 0 {
+			close(h.drained)
+		}
+	}
+	return h.backplane, topics, true
+}
+
+// Drain refuses new connections, asks every local connection to flush and
+// close, and waits until all of them have unregistered or ctx is done.
+func (h *Hub) Drain(ctx context.Context) error {
+	h.mu.Lock()
+	if !h.draining {
+		h.draining = true
+		h.drained = make(chan struct{})
+		if len(h.clients) == 0 {
+			close(h.drained)
+		}
+	}
+	drained := h.drained
+	var subs []Subscriber
+	for _, conns := range h.clients {
+		for _, s := range conns {
+			subs = append(subs, s)
+		}
+	}
+	h.mu.Unlock()
+
+	logging.GetLogger().Infof("draining %d connections", len(subs))
+	for _, s := range subs {
+		if d, ok := s.(drainer); ok {
+			d.drain()
+		}
+	}
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-func (h *Hub) SendNotification(userID uuid.UUID, message interface{}) {
+// Join adds a registered connection to topic, subscribing the backplane when
+// it is the topic's first member on this instance.
+func (h *Hub) Join(s Subscriber, topic string) error {
+	b, joined, err := h.join(s, topic)
+	if err != nil || !joined {
+		return err
+	}
+	h.channels.acquire(b, topicChannel(topic))
+	return nil
+}
+
+// join records the membership, reporting false when it already existed.
+func (h *Hub) join(s Subscriber, topic string) (Backplane, bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[s.Owner()][s.Key()]; !ok {
+		return nil, false, errNotConnected
+	}
+	joined, ok := h.joined[s.Key()]
+	if !ok {
+		joined = make(map[string]struct{})
+		h.joined[s.Key()] = joined
+	}
+	if _, ok := joined[topic]; ok {
+		return nil, false, nil
+	}
+	if len(joined) >= maxTopicsPerConnection {
+		return nil, false, errTooManyTopics
+	}
+	members, ok := h.topics[topic]
+	if !ok {
+		members = make(map[uuid.UUID]Subscriber)
+		h.topics[topic] = members
+	}
+	members[s.Key()] = s
+	joined[topic] = struct{}{}
+	return h.backplane, true, nil
+}
+
+// Leave drops one membership, releasing the topic's backplane subscription
+// with its last local member.
+func (h *Hub) Leave(s Subscriber, topic string) {
+	h.mu.Lock()
+	left := h.leaveLocked(s.Key(), topic)
+	b := h.backplane
+	h.mu.Unlock()
+	if left {
+		h.channels.release(b, topicChannel(topic))
+	}
+}
+
+// leaveLocked drops one membership, reporting whether it existed. Callers
+// hold h.mu and release the topic channel after unlocking.
+func (h *Hub) leaveLocked(key uuid.UUID, topic string) bool {
+	joined, ok := h.joined[key]
+	if !ok {
+		return false
+	}
+	if _, ok := joined[topic]; !ok {
+		return false
+	}
+	delete(joined, topic)
+	if len(joined) == 0 {
+		delete(h.joined, key)
+	}
+	if members, ok := h.topics[topic]; ok {
+		delete(members, key)
+		if len(members) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+	return true
+}
+
+// Topics lists the topics a connection has joined.
+func (h *Hub) Topics(s Subscriber) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	topics := make([]string, 0, len(h.joined[s.Key()]))
+	for topic := range h.joined[s.Key()] {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// Publish sends env to the user's channel; every instance holding a socket
+// for the user delivers it locally.
+func (h *Hub) Publish(userID uuid.UUID, env Envelope) {
+	h.publish(userChannel(userID), env)
+}
+
+// PublishTopic sends env to every member of topic on any instance.
+func (h *Hub) PublishTopic(topic string, env Envelope) {
+	h.publish(topicChannel(topic), env)
+}
+
+func (h *Hub) publish(channel string, env Envelope) {
+	payload, err := json.Marshal(env)
+	if err != nil {
+		logging.GetLogger().Errorf("error marshalling %s event for %s: %v", env.Type, channel, err)
+		return
+	}
 	h.mu.RLock()
-	client, ok := h.clients[userID]
+	b := h.backplane
 	h.mu.RUnlock()
-	if ok {
-		client.Send(message)
+	if err := b.Publish(context.Background(), channel, payload); err != nil {
+		logging.GetLogger().Errorf("backplane publish to %s failed: %v", channel, err)
+	}
+}
+
+func (h *Hub) deliverLocal(channel string, payload []byte) {
+	if channel == broadcastChannel {
+		h.deliverBroadcast(payload)
+		return
+	}
+	var env Envelope
+	if err := json.Unmarshal(payload, &env); err != nil {
+		logging.GetLogger().Errorf("backplane: malformed envelope on %s: %v", channel, err)
+		return
+	}
+	var subs []Subscriber
+	if raw, ok := strings.CutPrefix(channel, userChannelPrefix); ok {
+		userID, err := uuid.Parse(raw)
+		if err != nil {
+			logging.GetLogger().Warnf("backplane: unexpected channel %s", channel)
+			return
+		}
+		subs = h.subscribers(userID)
+	} else if topic, ok := strings.CutPrefix(channel, topicChannelPrefix); ok {
+		subs = h.members(topic)
+	} else {
+		logging.GetLogger().Warnf("backplane: unexpected channel %s", channel)
+		return
 	}
+	for _, sub := range subs {
+		sub.Send(env)
+	}
+}
+
+// subscribers returns a snapshot of the user's connections so sends happen
+// outside the lock.
+func (h *Hub) subscribers(userID uuid.UUID) []Subscriber {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	conns := h.clients[userID]
+	subs := make([]Subscriber, 0, len(conns))
+	for _, s := range conns {
+		subs = append(subs, s)
+	}
+	return subs
+}
+
+// members returns a snapshot of the topic's local members.
+func (h *Hub) members(topic string) []Subscriber {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	members := h.topics[topic]
+	subs := make([]Subscriber, 0, len(members))
+	for _, s := range members {
+		subs = append(subs, s)
+	}
+	return subs
+}
+
+// UseBackplane swaps the hub's backplane. It is meant to be called once at
+// startup, before any client connects.
+func UseBackplane(ctx context.Context, b Backplane) {
+	hub.mu.Lock()
+	hub.backplane = b
+	hub.mu.Unlock()
+	b.Start(ctx, hub.deliverLocal)
+	hub.subscribeBroadcast()
+}
+
+// UsePresence starts presence tracking. Like UseBackplane it is meant to be
+// called once at startup; users go offline in the store when ctx is done.
+func UsePresence(ctx context.Context, p *Presence) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	hub.presence = p
+	go p.run(ctx)
 }
 
-func Register(c *Client) {
-	hub.Register(c)
-	logging.GetLogger().Info("client registered: " + c.UserID.String())
+// Drain closes every connection on this instance for shutdown; see Hub.Drain.
+func Drain(ctx context.Context) error {
+	return hub.Drain(ctx)
+}
+
+func Register(s Subscriber) error {
+	return RegisterLimited(s, 0)
+}
+
+// RegisterLimited registers s if its user is below max connections.
+func RegisterLimited(s Subscriber, max int) error {
+	if err := hub.TryRegister(s, max); err != nil {
+		return err
+	}
+	logging.GetLogger().Infof("client registered: user=%s conn=%s", s.Owner(), s.Key())
+	return nil
+}
+
+func Unregister(s Subscriber) {
+	hub.Unregister(s)
+	logging.GetLogger().Infof("client unregistered: user=%s conn=%s", s.Owner(), s.Key())
+}
+
+// SendEvent pushes a typed event to all of the user's sockets.
+func SendEvent(u uuid.UUID, eventType, id string, payload interface{}) {
+	env, err := NewEnvelope(eventType, id, payload)
+	if err != nil {
+		logging.GetLogger().Errorf("error marshalling %s event for user %s: %v", eventType, u, err)
+		return
+	}
+	hub.Publish(u, env)
+}
+
+// SendNotification pushes a notification.created event to all of the user's sockets.
+func SendNotification(u uuid.UUID, n *model.Notification) {
+	env, err := notificationEnvelope(n)
+	if err != nil {
+		logging.GetLogger().Errorf("error marshalling notification %s: %v", n.ID, err)
+		return
+	}
+	hub.Publish(u, env)
 }
-func Unregister(u uuid.UUID)                        { hub.Unregister(u) }
-func SendNotification(u uuid.UUID, msg interface{}) { hub.SendNotification(u, msg) }
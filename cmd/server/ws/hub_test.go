@@ -0,0 +1,211 @@
+package ws
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// recordingBackplane delivers in-process like MemoryBackplane, tracks which
+// channels are subscribed and can hold Subscribe for chosen channels.
+type recordingBackplane struct {
+	MemoryBackplane
+
+	mu         sync.Mutex
+	subscribed map[string]int
+	block      map[string]chan struct{}
+}
+
+func newRecordingBackplane() *recordingBackplane {
+	return &recordingBackplane{subscribed: make(map[string]int), block: make(map[string]chan struct{})}
+}
+
+func (b *recordingBackplane) Subscribe(_ context.Context, channel string) error {
+	b.mu.Lock()
+	gate := b.block[channel]
+	b.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribed[channel]++
+	return nil
+}
+
+func (b *recordingBackplane) Unsubscribe(_ context.Context, channel string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribed[channel]--
+	return nil
+}
+
+func (b *recordingBackplane) subscriptions(channel string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.subscribed[channel]
+}
+
+func TestHubDeliversToEveryConnectionOfUser(t *testing.T) {
+	h := newHub(NewMemoryBackplane())
+	user := uuid.New()
+	tab1, tab2, other := NewRecorder(user), NewRecorder(user), NewRecorder(uuid.New())
+	for _, s := range []*Recorder{tab1, tab2, other} {
+		if err := h.Register(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	env, _ := NewEnvelope(EventMessage, "", "hi")
+	h.Publish(user, env)
+	if err := tab1.Expect(EventMessage); err != nil {
+		t.Fatal(err)
+	}
+	if err := tab2.Expect(EventMessage); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.ExpectNothing(); err != nil {
+		t.Fatal(err)
+	}
+
+	h.Unregister(tab1)
+	h.Publish(user, env)
+	if err := tab2.Expect(EventMessage); err != nil {
+		t.Fatal(err)
+	}
+	if err := tab1.ExpectNothing(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHubConnectionLimit(t *testing.T) {
+	h := newHub(NewMemoryBackplane())
+	user := uuid.New()
+	if err := h.TryRegister(NewRecorder(user), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.TryRegister(NewRecorder(user), 1); err != errConnectionLimit {
+		t.Fatalf("second connection: got %v, want errConnectionLimit", err)
+	}
+}
+
+func TestHubTopicMembership(t *testing.T) {
+	b := newRecordingBackplane()
+	h := newHub(b)
+	member, outsider := NewRecorder(uuid.New()), NewRecorder(uuid.New())
+	_ = h.Register(member)
+	_ = h.Register(outsider)
+
+	if err := h.Join(member, "post:1"); err != nil {
+		t.Fatal(err)
+	}
+	if n := b.subscriptions(topicChannel("post:1")); n != 1 {
+		t.Fatalf("topic subscribed %d times, want 1", n)
+	}
+
+	env, _ := NewEnvelope(EventMessage, "", "comment")
+	h.PublishTopic("post:1", env)
+	if err := member.Expect(EventMessage); err != nil {
+		t.Fatal(err)
+	}
+	if err := outsider.ExpectNothing(); err != nil {
+		t.Fatal(err)
+	}
+
+	h.Unregister(member)
+	if n := b.subscriptions(topicChannel("post:1")); n != 0 {
+		t.Fatalf("topic still subscribed after its last member left")
+	}
+	if err := h.Join(member, "post:1"); err != errNotConnected {
+		t.Fatalf("join after unregister: got %v, want errNotConnected", err)
+	}
+}
+
+// A backplane call that hangs must not hold the hub lock: other users keep
+// connecting and receiving while one subscription is stuck.
+func TestHubSlowSubscribeDoesNotStallOthers(t *testing.T) {
+	b := newRecordingBackplane()
+	h := newHub(b)
+	stuck, fine := uuid.New(), uuid.New()
+	gate := make(chan struct{})
+	b.block[userChannel(stuck)] = gate
+
+	registered := make(chan struct{})
+	go func() {
+		_ = h.Register(NewRecorder(stuck))
+		close(registered)
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s := NewRecorder(fine)
+		if err := h.Register(s); err != nil {
+			t.Error(err)
+			return
+		}
+		env, _ := NewEnvelope(EventMessage, "", "hi")
+		h.Publish(fine, env)
+		if err := s.Expect(EventMessage); err != nil {
+			t.Error(err)
+		}
+		h.Unregister(s)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("hub stalled behind a slow backplane subscribe")
+	}
+	close(gate)
+	<-registered
+}
+
+// Concurrent joins and leaves of one topic must leave exactly one
+// subscription while members remain and none once they are gone.
+func TestChannelRefsConverge(t *testing.T) {
+	b := newRecordingBackplane()
+	h := newHub(b)
+	subs := make([]*Recorder, 20)
+	for i := range subs {
+		subs[i] = NewRecorder(uuid.New())
+		_ = h.Register(subs[i])
+	}
+
+	var wg sync.WaitGroup
+	for _, s := range subs {
+		wg.Add(1)
+		go func(s *Recorder) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				_ = h.Join(s, "room:x")
+				h.Leave(s, "room:x")
+			}
+			_ = h.Join(s, "room:x")
+		}(s)
+	}
+	wg.Wait()
+	if n := b.subscriptions(topicChannel("room:x")); n != 1 {
+		t.Fatalf("topic subscribed %d times with members present, want 1", n)
+	}
+
+	for _, s := range subs {
+		wg.Add(1)
+		go func(s *Recorder) {
+			defer wg.Done()
+			h.Unregister(s)
+		}(s)
+	}
+	wg.Wait()
+	if n := b.subscriptions(topicChannel("room:x")); n != 0 {
+		t.Fatalf("topic subscribed %d times after every member left, want 0", n)
+	}
+	h.channels.mu.Lock()
+	defer h.channels.mu.Unlock()
+	if len(h.channels.chans) != 0 {
+		t.Fatalf("%d channel refs leaked", len(h.channels.chans))
+	}
+}
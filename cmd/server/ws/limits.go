@@ -0,0 +1,65 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+const rateLimitKeyPrefix = "ws:ratelimit:"
+
+// RateLimiter counts attempts per key within a window shared by all replicas.
+type RateLimiter interface {
+	// Allow records an attempt and reports whether it is within the limit,
+	// and if not, how long until the window resets
+	Allow(ctx context.Context, key string) (bool, time.Duration, error)
+}
+
+// fixedWindowScript increments the counter and starts the window on first use.
+var fixedWindowScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return {n, redis.call('PTTL', KEYS[1])}
+`)
+
+// RedisRateLimiter is a fixed-window limiter kept in Redis.
+type RedisRateLimiter struct {
+	client redis.Scripter
+	limit  int
+	window time.Duration
+}
+
+func NewRedisRateLimiter(client redis.Scripter, limit int, window time.Duration) *RedisRateLimiter {
+	if limit <= 0 {
+		limit = defaultHandshakeRateLimit
+	}
+	if window <= 0 {
+		window = defaultHandshakeRateWindow
+	}
+	return &RedisRateLimiter{client: client, limit: limit, window: window}
+}
+
+func (l *RedisRateLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	res, err := fixedWindowScript.Run(ctx, l.client, []string{rateLimitKeyPrefix + key}, l.window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return true, 0, err
+	}
+	count, ttl := res[0], time.Duration(res[1])*time.Millisecond
+	return count <= int64(l.limit), ttl, nil
+}
+
+// rejectSocket completes the handshake only to close it with a reason the
+// client can read; browsers do not expose the HTTP status of a failed upgrade.
+func rejectSocket(conn *websocket.Conn, code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(defaultWriteWait))
+	_ = conn.Close()
+}
+
+func retryReason(retryAfter time.Duration) string {
+	return fmt.Sprintf("handshake rate limit exceeded, retry in %ds", int(retryAfter.Round(time.Second).Seconds()))
+}
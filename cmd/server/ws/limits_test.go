@@ -0,0 +1,76 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisRateLimiterWindow(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	limiter := NewRedisRateLimiter(client, 2, time.Minute)
+
+	for i, want := range []bool{true, true, false} {
+		allowed, retryAfter, err := limiter.Allow(ctx, "ip:10.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != want {
+			t.Fatalf("attempt %d: allowed=%v, want %v", i+1, allowed, want)
+		}
+		if retryAfter <= 0 || retryAfter > time.Minute {
+			t.Fatalf("attempt %d: retry after %v, want within the window", i+1, retryAfter)
+		}
+	}
+	if allowed, _, _ := limiter.Allow(ctx, "ip:10.0.0.2"); !allowed {
+		t.Fatal("another IP shares the exhausted window")
+	}
+
+	mr.FastForward(time.Minute)
+	if allowed, _, _ := limiter.Allow(ctx, "ip:10.0.0.1"); !allowed {
+		t.Fatal("attempt after the window reset was refused")
+	}
+}
+
+// fixedLimiter answers every Allow the same way
+type fixedLimiter struct {
+	allowed bool
+	err     error
+}
+
+func (l fixedLimiter) Allow(context.Context, string) (bool, time.Duration, error) {
+	return l.allowed, 30 * time.Second, l.err
+}
+
+func TestLimitHandshakes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tc := range []struct {
+		name       string
+		limiter    RateLimiter
+		want       int
+		retryAfter string
+	}{
+		{"no limiter", nil, http.StatusOK, ""},
+		{"within the limit", fixedLimiter{allowed: true}, http.StatusOK, ""},
+		{"over the limit", fixedLimiter{allowed: false}, http.StatusTooManyRequests, "30"},
+		{"limiter down fails open", fixedLimiter{err: errors.New("redis: connection refused")}, http.StatusOK, ""},
+	} {
+		r := gin.New()
+		r.GET("/events", LimitHandshakes(tc.limiter, Config{}), func(c *gin.Context) { c.Status(http.StatusOK) })
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+		if w.Code != tc.want || w.Header().Get("Retry-After") != tc.retryAfter {
+			t.Errorf("%s: got %d with Retry-After %q, want %d with %q", tc.name, w.Code, w.Header().Get("Retry-After"), tc.want, tc.retryAfter)
+		}
+	}
+}
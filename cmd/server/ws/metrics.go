@@ -0,0 +1,17 @@
+package ws
+
+import "expvar"
+
+// Socket metrics, exported through expvar (GET /debug/vars).
+var (
+	metricActiveConnections   = expvar.NewInt("ws_connections_active")
+	metricDeadConnections     = expvar.NewInt("ws_dead_connections_total")
+	metricRejectedUpgrades    = expvar.NewInt("ws_upgrades_rejected_total")
+	metricExpiredSessions     = expvar.NewInt("ws_sessions_expired_total")
+	metricDroppedMessages     = expvar.NewInt("ws_messages_dropped_total")
+	metricRedeliveries        = expvar.NewInt("ws_redeliveries_total")
+	metricUndelivered         = expvar.NewInt("ws_deliveries_abandoned_total")
+	metricConnectionLimited   = expvar.NewInt("ws_connections_limited_total")
+	metricRateLimited         = expvar.NewInt("ws_handshakes_rate_limited_total")
+	metricBroadcastDeliveries = expvar.NewInt("ws_broadcast_deliveries_total")
+)
@@ -0,0 +1,126 @@
+package ws
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"net/http"
+	"notificationService/internal/model"
+	"time"
+)
+
+const (
+	defaultPollTimeout = 30 * time.Second
+	maxPollTimeout     = 60 * time.Second
+	pollBatchSize      = 100
+)
+
+// pollWaiter is registered with the hub for the duration of one long-poll
+// request; it only needs to know that something new arrived.
+type pollWaiter struct {
+	id     uuid.UUID
+	userID uuid.UUID
+	wake   chan struct{}
+}
+
+func (w *pollWaiter) Key() uuid.UUID   { return w.id }
+func (w *pollWaiter) Owner() uuid.UUID { return w.userID }
+func (w *pollWaiter) transient()       {}
+
+func (w *pollWaiter) Send(env Envelope) {
+	if env.Type != EventNotificationCreated {
+		return
+	}
+	w.drain()
+}
+
+// drain answers the poll right away with whatever is already stored.
+func (w *pollWaiter) drain() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// HandlePoll is the long-polling fallback: it answers right away when
+// notifications newer than `since` exist, otherwise it waits on the hub until
+// one arrives or `timeout` expires, and returns the batch with the next cursor.
+func HandlePoll(inbox InboxService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user_id missing in context"})
+			return
+		}
+		uid := userID.(uuid.UUID)
+
+		timeout := defaultPollTimeout
+		if t := c.Query("timeout"); t != "" {
+			parsed, err := time.ParseDuration(t)
+			if err != nil || parsed < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid timeout"})
+				return
+			}
+			timeout = min(parsed, maxPollTimeout)
+		}
+
+		cursor := &ResumeCursor{After: time.Now().UTC()}
+		if since := c.Query("since"); since != "" {
+			parsed, err := ParseResumeCursor(c.Request.Context(), inbox, uid, since)
+			if err != nil {
+				if errors.Is(err, ErrInvalidCursor) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			cursor = parsed
+		}
+
+		// register before the first query so a notification committed in
+		// between still wakes us
+		waiter := &pollWaiter{id: uuid.New(), userID: uid, wake: make(chan struct{}, 1)}
+		if err := Register(waiter); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		defer Unregister(waiter)
+
+		batch, err := inbox.GetNotificationsAfter(c.Request.Context(), uid, cursor.After, cursor.AfterID, pollBatchSize)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if len(batch) == 0 {
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			select {
+			case <-waiter.wake:
+				batch, err = inbox.GetNotificationsAfter(c.Request.Context(), uid, cursor.After, cursor.AfterID, pollBatchSize)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+			case <-timer.C:
+			case <-c.Request.Context().Done():
+				return
+			}
+		}
+
+		if batch == nil {
+			batch = []model.Notification{}
+		}
+		next := *cursor
+		if len(batch) > 0 {
+			last := batch[len(batch)-1]
+			next = ResumeCursor{After: last.CreatedAt, AfterID: last.ID}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"notifications": batch,
+			"next_cursor":   next.String(),
+			"has_more":      len(batch) == pollBatchSize,
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"notificationService/internal/model"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type pollResponse struct {
+	Notifications []model.Notification `json:"notifications"`
+	NextCursor    string               `json:"next_cursor"`
+}
+
+func poll(t *testing.T, inbox InboxService, user uuid.UUID, query url.Values) (int, pollResponse) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/poll", func(c *gin.Context) { c.Set("user_id", user) }, HandlePoll(inbox))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/poll?"+query.Encode(), nil))
+	var body pollResponse
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code, body
+}
+
+func TestPollCursorSurvivesDeletion(t *testing.T) {
+	user := uuid.New()
+	feed := newSliceFeed(user, 3)
+	inbox := stubInbox{sliceFeed: feed}
+
+	code, first := poll(t, inbox, user, url.Values{"since": {feed[0].ID.String()}, "timeout": {"0s"}})
+	if code != http.StatusOK || len(first.Notifications) != 2 {
+		t.Fatalf("first poll: got %d with %d notifications, want 200 with 2", code, len(first.Notifications))
+	}
+
+	// the client deletes the last notification it saw before polling again
+	inbox.sliceFeed = feed[:2]
+	code, second := poll(t, inbox, user, url.Values{"since": {first.NextCursor}, "timeout": {"0s"}})
+	if code != http.StatusOK || len(second.Notifications) != 0 {
+		t.Fatalf("poll after delete: got %d with %d notifications, want 200 with none", code, len(second.Notifications))
+	}
+	if second.NextCursor != first.NextCursor {
+		t.Fatalf("empty poll moved the cursor from %s to %s", first.NextCursor, second.NextCursor)
+	}
+
+	inbox.sliceFeed = append(feed[:2:2], model.Notification{ID: uuid.New(), UserID: user, CreatedAt: feed[2].CreatedAt.Add(time.Second)})
+	code, third := poll(t, inbox, user, url.Values{"since": {first.NextCursor}, "timeout": {"0s"}})
+	if code != http.StatusOK || len(third.Notifications) != 1 || third.Notifications[0].ID != inbox.sliceFeed[2].ID {
+		t.Fatalf("poll after a new notification: got %d with %v", code, third.Notifications)
+	}
+}
+
+func TestPollRejectsBadParameters(t *testing.T) {
+	user := uuid.New()
+	inbox := stubInbox{sliceFeed: newSliceFeed(user, 1)}
+	for _, tc := range []struct {
+		name  string
+		query url.Values
+	}{
+		{"unknown id", url.Values{"since": {uuid.NewString()}}},
+		{"foreign id", url.Values{"since": {newSliceFeed(uuid.New(), 1)[0].ID.String()}}},
+		{"garbage cursor", url.Values{"since": {"not a cursor"}}},
+		{"negative timeout", url.Values{"timeout": {"-1s"}}},
+		{"malformed timeout", url.Values{"timeout": {"soon"}}},
+	} {
+		if code, _ := poll(t, inbox, user, tc.query); code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", tc.name, code)
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"github.com/Sayan80bayev/go-project/pkg/logging"
+	"github.com/Sayan80bayev/go-project/pkg/messaging"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"notificationService/internal/events"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	presenceKeyPrefix = "ws:presence:user:"
+	lastSeenKey       = "ws:presence:last_seen"
+
+	// an instance that stops heartbeating (crash, network split) stops
+	// counting towards presence once its entries expire
+	presenceTTL       = 90 * time.Second
+	presenceHeartbeat = 30 * time.Second
+	maxPresenceLookup = 100
+)
+
+// PresenceStatus is what GET /presence reports per user.
+type PresenceStatus struct {
+	UserID   uuid.UUID  `json:"user_id"`
+	Online   bool       `json:"online"`
+	LastSeen *time.Time `json:"last_seen"`
+}
+
+// PresenceStore records which instances hold live connections for a user.
+type PresenceStore interface {
+	// Connect marks the user online on instance until expiresAt and reports
+	// whether no other instance had them online
+	Connect(ctx context.Context, userID uuid.UUID, instance string, expiresAt time.Time) (bool, error)
+	// Disconnect removes the instance and reports whether it was the user's last
+	Disconnect(ctx context.Context, userID uuid.UUID, instance string, at time.Time) (bool, error)
+	// Refresh extends the instance's entries for users it still holds
+	Refresh(ctx context.Context, userIDs []uuid.UUID, instance string, expiresAt time.Time) error
+	Lookup(ctx context.Context, userIDs []uuid.UUID, now time.Time) ([]PresenceStatus, error)
+}
+
+// MemoryPresenceStore keeps presence in-process; suitable for a single node.
+type MemoryPresenceStore struct {
+	mu        sync.Mutex
+	instances map[uuid.UUID]map[string]time.Time
+	lastSeen  map[uuid.UUID]time.Time
+}
+
+func NewMemoryPresenceStore() *MemoryPresenceStore {
+	return &MemoryPresenceStore{
+		instances: make(map[uuid.UUID]map[string]time.Time),
+		lastSeen:  make(map[uuid.UUID]time.Time),
+	}
+}
+
+func (s *MemoryPresenceStore) Connect(_ context.Context, userID uuid.UUID, instance string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	first := s.liveLocked(userID, time.Now()) == 0
+	if s.instances[userID] == nil {
+		s.instances[userID] = make(map[string]time.Time)
+	}
+	s.instances[userID][instance] = expiresAt
+	return first, nil
+}
+
+func (s *MemoryPresenceStore) Disconnect(_ context.Context, userID uuid.UUID, instance string, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.instances[userID], instance)
+	s.lastSeen[userID] = at
+	last := s.liveLocked(userID, at) == 0
+	if last {
+		delete(s.instances, userID)
+	}
+	return last, nil
+}
+
+func (s *MemoryPresenceStore) Refresh(_ context.Context, userIDs []uuid.UUID, instance string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range userIDs {
+		if s.instances[id] == nil {
+			s.instances[id] = make(map[string]time.Time)
+		}
+		s.instances[id][instance] = expiresAt
+	}
+	return nil
+}
+
+func (s *MemoryPresenceStore) Lookup(_ context.Context, userIDs []uuid.UUID, now time.Time) ([]PresenceStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]PresenceStatus, len(userIDs))
+	for i, id := range userIDs {
+		statuses[i] = PresenceStatus{UserID: id}
+		if s.liveLocked(id, now) > 0 {
+			statuses[i].Online = true
+			statuses[i].LastSeen = &now
+		} else if seen, ok := s.lastSeen[id]; ok {
+			statuses[i].LastSeen = &seen
+		}
+	}
+	return statuses, nil
+}
+
+// liveLocked counts the user's unexpired instances. Callers hold s.mu.
+func (s *MemoryPresenceStore) liveLocked(userID uuid.UUID, now time.Time) int {
+	live := 0
+	for instance, expiresAt := range s.instances[userID] {
+		if expiresAt.After(now) {
+			live++
+		} else {
+			delete(s.instances[userID], instance)
+		}
+	}
+	return live
+}
+
+// Each user has a sorted set of instance IDs scored by heartbeat expiry;
+// last-seen times share one hash.
+var (
+	presenceConnectScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[3])
+local before = redis.call('ZCARD', KEYS[1])
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+redis.call('PEXPIREAT', KEYS[1], ARGV[2])
+return before
+`)
+	presenceDisconnectScript = redis.NewScript(`
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[2])
+redis.call('HSET', KEYS[2], ARGV[3], ARGV[2])
+return redis.call('ZCARD', KEYS[1])
+`)
+)
+
+// RedisPresenceStore shares presence between instances.
+type RedisPresenceStore struct {
+	client redis.Cmdable
+}
+
+func NewRedisPresenceStore(client redis.Cmdable) *RedisPresenceStore {
+	return &RedisPresenceStore{client: client}
+}
+
+func (s *RedisPresenceStore) Connect(ctx context.Context, userID uuid.UUID, instance string, expiresAt time.Time) (bool, error) {
+	before, err := presenceConnectScript.Run(ctx, s.client, []string{presenceKey(userID)},
+		instance, expiresAt.UnixMilli(), time.Now().UnixMilli()).Int64()
+	if err != nil {
+		return false, err
+	}
+	return before == 0, nil
+}
+
+func (s *RedisPresenceStore) Disconnect(ctx context.Context, userID uuid.UUID, instance string, at time.Time) (bool, error) {
+	remaining, err := presenceDisconnectScript.Run(ctx, s.client, []string{presenceKey(userID), lastSeenKey},
+		instance, at.UnixMilli(), userID.String()).Int64()
+	if err != nil {
+		return false, err
+	}
+	return remaining == 0, nil
+}
+
+func (s *RedisPresenceStore) Refresh(ctx context.Context, userIDs []uuid.UUID, instance string, expiresAt time.Time) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range userIDs {
+			pipe.ZAdd(ctx, presenceKey(id), redis.Z{Score: float64(expiresAt.UnixMilli()), Member: instance})
+			pipe.PExpireAt(ctx, presenceKey(id), expiresAt)
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *RedisPresenceStore) Lookup(ctx context.Context, userIDs []uuid.UUID, now time.Time) ([]PresenceStatus, error) {
+	if len(userIDs) == 0 {
+		return []PresenceStatus{}, nil
+	}
+	fields := make([]string, len(userIDs))
+	counts := make([]*redis.IntCmd, len(userIDs))
+	var seen *redis.SliceCmd
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		min := strconv.FormatInt(now.UnixMilli(), 10)
+		for i, id := range userIDs {
+			fields[i] = id.String()
+			counts[i] = pipe.ZCount(ctx, presenceKey(id), "("+min, "+inf")
+		}
+		seen = pipe.HMGet(ctx, lastSeenKey, fields...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]PresenceStatus, len(userIDs))
+	for i, id := range userIDs {
+		statuses[i] = PresenceStatus{UserID: id}
+		if counts[i].Val() > 0 {
+			statuses[i].Online = true
+			statuses[i].LastSeen = &now
+			continue
+		}
+		if raw, ok := seen.Val()[i].(string); ok {
+			if ms, err := strconv.ParseInt(raw, 10, 64); err == nil {
+				t := time.UnixMilli(ms).UTC()
+				statuses[i].LastSeen = &t
+			}
+		}
+	}
+	return statuses, nil
+}
+
+func presenceKey(userID uuid.UUID) string {
+	return presenceKeyPrefix + userID.String()
+}
+
+type presenceChange struct {
+	userID uuid.UUID
+	online bool
+	at     time.Time
+}
+
+// Presence tracks which users hold live connections on this instance, mirrors
+// that into the shared store and publishes presence.changed when a user comes
+// online on their first instance or goes offline on their last. Users whose
+// instance dies without a clean shutdown go offline once its entries expire,
+// without an event, so GET /presence stays the source of truth.
+type Presence struct {
+	store    PresenceStore
+	producer messaging.Producer
+	instance string
+	// wake signals run that pending holds changes
+	wake chan struct{}
+	done chan struct{}
+	log  *logrus.Logger
+
+	mu    sync.RWMutex
+	local map[uuid.UUID]struct{}
+	// pending keeps at most one unapplied change per user, so a slow store
+	// coalesces flapping connections instead of queueing them; a change that
+	// undoes the pending one cancels it, as the store never saw either
+	pending map[uuid.UUID]presenceChange
+}
+
+// NewPresence builds a registry; a nil producer skips publishing events.
+func NewPresence(store PresenceStore, producer messaging.Producer) *Presence {
+	return &Presence{
+		store:    store,
+		producer: producer,
+		instance: uuid.NewString(),
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		log:      logging.GetLogger(),
+		local:    make(map[uuid.UUID]struct{}),
+		pending:  make(map[uuid.UUID]presenceChange),
+	}
+}
+
+// connected and disconnected are called by the hub under its lock and never
+// block; run applies each user's latest state, so a quick reconnect cannot
+// be reordered.
+func (p *Presence) connected(userID uuid.UUID) {
+	p.enqueue(presenceChange{userID: userID, online: true, at: time.Now().UTC()})
+}
+
+func (p *Presence) disconnected(userID uuid.UUID) {
+	p.enqueue(presenceChange{userID: userID, online: false, at: time.Now().UTC()})
+}
+
+// Stopped is closed once run has marked this instance's users offline.
+func (p *Presence) Stopped() <-chan struct{} {
+	return p.done
+}
+
+// enqueue records change, replacing or cancelling any unapplied one of the
+// same user, and wakes run without waiting for it.
+func (p *Presence) enqueue(change presenceChange) {
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+	p.mu.Lock()
+	if change.online {
+		p.local[change.userID] = struct{}{}
+	} else {
+		delete(p.local, change.userID)
+	}
+	if prev, ok := p.pending[change.userID]; ok && prev.online != change.online {
+		delete(p.pending, change.userID)
+	} else {
+		p.pending[change.userID] = change
+	}
+	p.mu.Unlock()
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// takePending hands the coalesced changes to run.
+func (p *Presence) takePending() map[uuid.UUID]presenceChange {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.pending) == 0 {
+		return nil
+	}
+	pending := p.pending
+	p.pending = make(map[uuid.UUID]presenceChange)
+	return pending
+}
+
+// run applies changes and heartbeats until ctx is done, then marks this
+// instance's users offline.
+func (p *Presence) run(ctx context.Context) {
+	heartbeat := time.NewTicker(presenceHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-p.wake:
+			for _, change := range p.takePending() {
+				p.apply(change)
+			}
+		case <-heartbeat.C:
+			if err := p.store.Refresh(ctx, p.localUsers(), p.instance, time.Now().Add(presenceTTL)); err != nil {
+				p.log.Errorf("presence heartbeat failed: %v", err)
+			}
+		case <-ctx.Done():
+			p.shutdown()
+			close(p.done)
+			return
+		}
+	}
+}
+
+func (p *Presence) apply(change presenceChange) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	var changed bool
+	var err error
+	if change.online {
+		changed, err = p.store.Connect(ctx, change.userID, p.instance, change.at.Add(presenceTTL))
+	} else {
+		changed, err = p.store.Disconnect(ctx, change.userID, p.instance, change.at)
+	}
+	if err != nil {
+		p.log.Errorf("presence update for user %s failed: %v", change.userID, err)
+		return
+	}
+	if !changed || p.producer == nil {
+		return
+	}
+	err = p.producer.Produce(ctx, events.PresenceChanged, events.PresenceChangedPayload{
+		UserID:   change.userID,
+		Online:   change.online,
+		LastSeen: change.at.Unix(),
+	})
+	if err != nil {
+		p.log.Errorf("publishing presence change for user %s failed: %v", change.userID, err)
+	}
+}
+
+func (p *Presence) shutdown() {
+	for _, change := range p.takePending() {
+		p.apply(change)
+	}
+	now := time.Now().UTC()
+	for _, id := range p.localUsers() {
+		p.apply(presenceChange{userID: id, online: false, at: now})
+	}
+}
+
+func (p *Presence) localUsers() []uuid.UUID {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	ids := make([]uuid.UUID, 0, len(p.local))
+	for id := range p.local {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Lookup answers users connected to this instance directly and asks the
+// store about the rest.
+func (p *Presence) Lookup(ctx context.Context, userIDs []uuid.UUID) ([]PresenceStatus, error) {
+	now := time.Now().UTC()
+	statuses := make([]PresenceStatus, len(userIDs))
+	var remote []uuid.UUID
+	var remoteIdx []int
+	p.mu.RLock()
+	for i, id := range userIDs {
+		if _, ok := p.local[id]; ok {
+			statuses[i] = PresenceStatus{UserID: id, Online: true, LastSeen: &now}
+			continue
+		}
+		remote = append(remote, id)
+		remoteIdx = append(remoteIdx, i)
+	}
+	p.mu.RUnlock()
+
+	if len(remote) > 0 {
+		found, err := p.store.Lookup(ctx, remote, now)
+		if err != nil {
+			return nil, err
+		}
+		for j, status := range found {
+			statuses[remoteIdx[j]] = status
+		}
+	}
+	return statuses, nil
+}
+
+// HandlePresence reports presence for `user_ids`, given comma-separated or
+// repeated, for services deciding whether to fall back to push or email. It
+// is mounted behind a service-account check so users cannot probe who is online.
+func HandlePresence() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hub.mu.RLock()
+		p := hub.presence
+		hub.mu.RUnlock()
+		if p == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "presence tracking is disabled"})
+			return
+		}
+
+		var ids []uuid.UUID
+		for _, param := range c.QueryArray("user_ids") {
+			for _, raw := range strings.Split(param, ",") {
+				if raw = strings.TrimSpace(raw); raw == "" {
+					continue
+				}
+				id, err := uuid.Parse(raw)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id: " + raw})
+					return
+				}
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user_ids is required"})
+			return
+		}
+		if len(ids) > maxPresenceLookup {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d user_ids per request", maxPresenceLookup)})
+			return
+		}
+
+		statuses, err := p.Lookup(c.Request.Context(), ids)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"presence": statuses})
+	}
+}
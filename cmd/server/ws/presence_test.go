@@ -0,0 +1,61 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"notificationService/internal/events"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// presenceLog records published presence events instead of sending them
+type presenceLog []bool
+
+func (l *presenceLog) Produce(_ context.Context, _ string, data interface{}) error {
+	*l = append(*l, data.(events.PresenceChangedPayload).Online)
+	return nil
+}
+
+func (l *presenceLog) Close() {}
+
+// flush applies what run would pick up on its next wake
+func flush(p *Presence) {
+	for _, change := range p.takePending() {
+		p.apply(change)
+	}
+}
+
+func TestPresenceCoalescesFlappingConnections(t *testing.T) {
+	for _, tc := range []struct {
+		// + is the user's first socket opening, - their last closing and |
+		// run applying what is pending
+		steps string
+		want  []bool
+	}{
+		{"+", []bool{true}},
+		{"+-", nil},
+		{"+|-+", []bool{true}},
+		{"+|-", []bool{true, false}},
+		{"+-+", []bool{true}},
+	} {
+		var published presenceLog
+		p := NewPresence(NewMemoryPresenceStore(), &published)
+		user := uuid.New()
+		for _, step := range tc.steps {
+			switch step {
+			case '+':
+				p.connected(user)
+			case '-':
+				p.disconnected(user)
+			case '|':
+				flush(p)
+			}
+		}
+		flush(p)
+
+		if fmt.Sprint(published) != fmt.Sprint(presenceLog(tc.want)) {
+			t.Errorf("%s: published %v, want %v", tc.steps, published, tc.want)
+		}
+	}
+}
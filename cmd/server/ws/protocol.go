@@ -0,0 +1,171 @@
+package ws
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"notificationService/internal/model"
+	"time"
+)
+
+// ProtocolVersion is stamped on every envelope; clients may omit it.
+const ProtocolVersion = 1
+
+// Server → client events.
+const (
+	EventNotificationCreated = "notification.created"
+	EventNotificationRead    = "notification.read"
+	// EventNotificationUnread and EventNotificationDeleted follow changes made
+	// elsewhere, over REST or another socket
+	EventNotificationUnread  = "notification.unread"
+	EventNotificationDeleted = "notification.deleted"
+	// EventNotificationDelivered tells a user's other sockets that a push was acknowledged
+	EventNotificationDelivered = "notification.delivered"
+	EventUnreadCount           = "unread_count"
+	EventMessage               = "message"
+	EventBroadcast             = "broadcast"
+	EventResyncRequired        = "resync_required"
+	EventReauthRequired        = "reauth_required"
+	EventPong                  = "pong"
+	EventResult                = "result"
+	EventError                 = "error"
+)
+
+// Client → server commands.
+const (
+	CommandMarkRead    = "mark_read"
+	CommandMarkAllRead = "mark_all_read"
+	CommandAck         = "ack"
+	CommandSubscribe   = "subscribe"
+	CommandUnsubscribe = "unsubscribe"
+	CommandPing        = "ping"
+	CommandReauth      = "reauth"
+)
+
+// Envelope frames every message in both directions. For events ID identifies
+// the subject (the notification ID for notification.created); for commands it
+// is chosen by the client and echoed back on the result or error.
+// DeliveryID is stamped on each push that must be acknowledged with an ack command.
+// Topic names the topic an event was published to; it is empty for inbox events.
+// Cursor is set on notification.created; passed back as `since` it resumes
+// after that notification, even once the notification has been deleted.
+type Envelope struct {
+	V          int             `json:"v"`
+	Type       string          `json:"type"`
+	ID         string          `json:"id,omitempty"`
+	DeliveryID string          `json:"delivery_id,omitempty"`
+	Topic      string          `json:"topic,omitempty"`
+	Cursor     string          `json:"cursor,omitempty"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+}
+
+// NewEnvelope builds a current-version envelope around payload.
+func NewEnvelope(eventType, id string, payload interface{}) (Envelope, error) {
+	env := Envelope{V: ProtocolVersion, Type: eventType, ID: id}
+	if payload == nil {
+		return env, nil
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Envelope{}, err
+	}
+	env.Payload = data
+	return env, nil
+}
+
+func notificationEnvelope(n *model.Notification) (Envelope, error) {
+	env, err := NewEnvelope(EventNotificationCreated, n.ID.String(), n)
+	if err != nil {
+		return Envelope{}, err
+	}
+	env.Cursor = ResumeCursor{After: n.CreatedAt, AfterID: n.ID}.String()
+	return env, nil
+}
+
+// NotificationReadPayload reports notifications that became read. With All
+// set, every notification matching Type and Before (when given) is read.
+type NotificationReadPayload struct {
+	IDs    []uuid.UUID            `json:"ids,omitempty"`
+	All    bool                   `json:"all,omitempty"`
+	Type   model.NotificationType `json:"type,omitempty"`
+	Before *time.Time             `json:"before,omitempty"`
+	ReadAt time.Time              `json:"read_at"`
+}
+
+// NotificationIDsPayload lists the notifications a notification.unread or
+// notification.deleted event refers to.
+type NotificationIDsPayload struct {
+	IDs []uuid.UUID `json:"ids"`
+}
+
+type UnreadCountPayload struct {
+	Count int64 `json:"count"`
+}
+
+type ResyncPayload struct {
+	Dropped int `json:"dropped"`
+}
+
+type ErrorPayload struct {
+	Message string `json:"message"`
+}
+
+// ReauthRequiredPayload announces when the session's token expires; the
+// same shape answers a successful reauth command.
+type ReauthRequiredPayload struct {
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ReauthCommand carries a refreshed access token for the same user.
+type ReauthCommand struct {
+	Token string `json:"token"`
+}
+
+type MarkReadCommand struct {
+	NotificationID uuid.UUID `json:"notification_id"`
+}
+
+// MarkAllReadCommand optionally narrows mark_all_read to a type or to
+// notifications created before a time.
+type MarkAllReadCommand struct {
+	Type   model.NotificationType `json:"type,omitempty"`
+	Before *time.Time             `json:"before,omitempty"`
+}
+
+// AckCommand confirms receipt of a push, identified by its delivery ID or,
+// failing that, by the notification ID.
+type AckCommand struct {
+	DeliveryID     string    `json:"delivery_id,omitempty"`
+	NotificationID uuid.UUID `json:"notification_id,omitempty"`
+}
+
+type DeliveredPayload struct {
+	NotificationID uuid.UUID `json:"notification_id"`
+	DeliveredAt    time.Time `json:"delivered_at"`
+}
+
+// SubscribeCommand (re)subscribes to the inbox, replaying everything after
+// Since (an event cursor, a notification ID or an RFC 3339 timestamp) when
+// given and redelivering unacknowledged pushes, and joins Topics.
+type SubscribeCommand struct {
+	Since  string   `json:"since,omitempty"`
+	Topics []string `json:"topics,omitempty"`
+}
+
+// UnsubscribeCommand leaves Topics.
+type UnsubscribeCommand struct {
+	Topics []string `json:"topics"`
+}
+
+// SubscriptionPayload answers subscribe and unsubscribe with the unread count
+// and the topics the socket is now in.
+type SubscriptionPayload struct {
+	Count  int64    `json:"count"`
+	Topics []string `json:"topics"`
+}
+
+// BroadcastPayload is an operator notice such as a maintenance banner.
+type BroadcastPayload struct {
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	SentAt  time.Time       `json:"sent_at"`
+}
@@ -0,0 +1,65 @@
+package ws
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	recorderBuffer  = 64
+	recorderTimeout = time.Second
+	recorderQuiet   = 20 * time.Millisecond
+)
+
+// Recorder is a Subscriber that queues what it is sent instead of writing to
+// a socket. Like MemoryBackplane it is meant for tests, in this package and
+// in the ones that publish through it.
+type Recorder struct {
+	key, owner uuid.UUID
+	events     chan Envelope
+}
+
+func NewRecorder(owner uuid.UUID) *Recorder {
+	return &Recorder{key: uuid.New(), owner: owner, events: make(chan Envelope, recorderBuffer)}
+}
+
+func (r *Recorder) Key() uuid.UUID    { return r.key }
+func (r *Recorder) Owner() uuid.UUID  { return r.owner }
+func (r *Recorder) Send(env Envelope) { r.events <- env }
+
+// Expect consumes one event per type, in order, waiting up to a second for each
+func (r *Recorder) Expect(eventTypes ...string) error {
+	for _, want := range eventTypes {
+		select {
+		case env := <-r.events:
+			if env.Type != want {
+				return fmt.Errorf("got %s event, want %s", env.Type, want)
+			}
+		case <-time.After(recorderTimeout):
+			return fmt.Errorf("no %s event delivered", want)
+		}
+	}
+	return nil
+}
+
+// ExpectNothing fails if an event arrives shortly
+func (r *Recorder) ExpectNothing() error {
+	select {
+	case env := <-r.events:
+		return fmt.Errorf("unexpected %s event", env.Type)
+	case <-time.After(recorderQuiet):
+		return nil
+	}
+}
+
+// Next returns the next event, or false when none arrives within a second
+func (r *Recorder) Next() (Envelope, bool) {
+	select {
+	case env := <-r.events:
+		return env, true
+	case <-time.After(recorderTimeout):
+		return Envelope{}, false
+	}
+}
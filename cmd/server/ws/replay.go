@@ -0,0 +1,164 @@
+package ws
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"notificationService/internal/model"
+	"time"
+)
+
+const replayPageSize = 100
+
+var ErrInvalidCursor = errors.New("invalid resume cursor")
+
+// InboxService is the part of service.NotificationService that the socket
+// protocol drives; it is declared here because the service package imports ws.
+type InboxService interface {
+	NotificationFeed
+	MarkNotificationAsRead(ctx context.Context, userID, id uuid.UUID) (time.Time, error)
+	MarkAllNotificationsAsRead(ctx context.Context, userID uuid.UUID, filter model.ReadAllFilter) (int64, error)
+	CountUnread(ctx context.Context, userID uuid.UUID) (int64, error)
+	GetUndeliveredNotifications(ctx context.Context, userID uuid.UUID, since time.Time, maxAttempts, limit int) ([]model.Notification, error)
+	MarkNotificationDelivered(ctx context.Context, userID, id uuid.UUID) (bool, error)
+	RecordDeliveryAttempts(ctx context.Context, userID uuid.UUID, attempts map[uuid.UUID]int) error
+}
+
+// NotificationFeed is the persisted notification source used to replay what a
+// reconnecting client missed while it was offline.
+type NotificationFeed interface {
+	GetNotificationByID(ctx context.Context, userID, id uuid.UUID) (*model.Notification, error)
+	GetNotificationsAfter(ctx context.Context, userID uuid.UUID, after time.Time, afterID uuid.UUID, limit int) ([]model.Notification, error)
+}
+
+// ResumeCursor marks the last notification a client has seen.
+type ResumeCursor struct {
+	After   time.Time
+	AfterID uuid.UUID
+}
+
+// String encodes the cursor as an opaque (created_at, id) key, the same
+// shape as the feed's page cursors. Unlike a bare ID it stays valid after
+// the notification it names is deleted.
+func (c ResumeCursor) String() string {
+	data, _ := json.Marshal(model.Cursor{CreatedAt: c.After, ID: c.AfterID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseResumeCursor accepts the ID of the last seen notification, an RFC 3339
+// timestamp, or a cursor produced by ResumeCursor.String. IDs are resolved
+// against the feed and must belong to the user, so unlike cursors they stop
+// working once the notification is deleted.
+func ParseResumeCursor(ctx context.Context, feed NotificationFeed, userID uuid.UUID, raw string) (*ResumeCursor, error) {
+	if id, err := uuid.Parse(raw); err == nil {
+		n, err := feed.GetNotificationByID(ctx, userID, id)
+		if errors.Is(err, model.ErrNotFound) {
+			return nil, ErrInvalidCursor
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &ResumeCursor{After: n.CreatedAt, AfterID: n.ID}, nil
+	}
+
+	if ts, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+		return &ResumeCursor{After: ts}, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c model.Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.CreatedAt.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return &ResumeCursor{After: c.CreatedAt.UTC(), AfterID: c.ID}, nil
+}
+
+// replayBacklog walks every persisted notification newer than the cursor,
+// oldest first, and hands each to emit as an envelope. It returns the IDs it
+// emitted and stops early when emit reports false.
+func replayBacklog(ctx context.Context, feed NotificationFeed, userID uuid.UUID, cursor ResumeCursor, emit func(Envelope) bool) (map[uuid.UUID]struct{}, error) {
+	seen := make(map[uuid.UUID]struct{})
+	after, afterID := cursor.After, cursor.AfterID
+
+	for {
+		page, err := feed.GetNotificationsAfter(ctx, userID, after, afterID, replayPageSize)
+		if err != nil {
+			return seen, err
+		}
+		for i := range page {
+			n := &page[i]
+			after, afterID = n.CreatedAt, n.ID
+			env, err := notificationEnvelope(n)
+			if err != nil {
+				continue
+			}
+			if !emit(env) {
+				return seen, nil
+			}
+			seen[n.ID] = struct{}{}
+		}
+		if len(page) < replayPageSize {
+			return seen, nil
+		}
+	}
+}
+
+// isReplayed reports whether env is a notification already sent from the backlog.
+func isReplayed(env Envelope, seen map[uuid.UUID]struct{}) bool {
+	if env.Type != EventNotificationCreated {
+		return false
+	}
+	id, err := uuid.Parse(env.ID)
+	if err != nil {
+		return false
+	}
+	_, ok := seen[id]
+	return ok
+}
+
+// replay streams every persisted notification newer than the cursor and
+// redelivers older unacknowledged ones, then flushes live messages that were
+// held back meanwhile, skipping those already sent, before switching the
+// client to live delivery.
+func (c *Client) replay(feed NotificationFeed, cursor ResumeCursor) {
+	gone := false
+	seen, err := replayBacklog(context.Background(), feed, c.UserID, cursor, func(env Envelope) bool {
+		gone = !c.deliver(env)
+		return !gone
+	})
+	if gone {
+		return
+	}
+	if err != nil {
+		c.log.Errorf("replay for user %s failed: %v", c.UserID, err)
+	}
+	if !c.redeliver(seen) {
+		return
+	}
+
+	for {
+		c.mu.Lock()
+		pending := c.pending
+		c.pending = nil
+		if len(pending) == 0 {
+			c.replaying = false
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Unlock()
+
+		for _, msg := range pending {
+			if isReplayed(msg, seen) {
+				continue
+			}
+			if !c.deliver(msg) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"notificationService/internal/model"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sayan80bayev/go-project/pkg/logging"
+	"github.com/google/uuid"
+)
+
+// sliceFeed serves one user's notifications, oldest first
+type sliceFeed []model.Notification
+
+func newSliceFeed(user uuid.UUID, n int) sliceFeed {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	feed := make(sliceFeed, n)
+	for i := range feed {
+		feed[i] = model.Notification{ID: uuid.New(), UserID: user, Title: "t", CreatedAt: start.Add(time.Duration(i) * time.Second)}
+	}
+	return feed
+}
+
+func (f sliceFeed) GetNotificationByID(_ context.Context, userID, id uuid.UUID) (*model.Notification, error) {
+	for i := range f {
+		if f[i].ID == id && f[i].UserID == userID {
+			return &f[i], nil
+		}
+	}
+	return nil, model.ErrNotFound
+}
+
+func (f sliceFeed) GetNotificationsAfter(_ context.Context, userID uuid.UUID, after time.Time, _ uuid.UUID, limit int) ([]model.Notification, error) {
+	var page []model.Notification
+	for _, n := range f {
+		// timestamps are unique here, so afterID never breaks a tie
+		if n.UserID != userID || !n.CreatedAt.After(after) {
+			continue
+		}
+		if len(page) == limit {
+			break
+		}
+		page = append(page, n)
+	}
+	return page, nil
+}
+
+// stubInbox serves a feed and accepts every write without storing it
+type stubInbox struct {
+	sliceFeed
+	undelivered []model.Notification
+}
+
+func (stubInbox) MarkNotificationAsRead(context.Context, uuid.UUID, uuid.UUID) (time.Time, error) {
+	return time.Now().UTC(), nil
+}
+func (stubInbox) MarkAllNotificationsAsRead(context.Context, uuid.UUID, model.ReadAllFilter) (int64, error) {
+	return 0, nil
+}
+func (stubInbox) CountUnread(context.Context, uuid.UUID) (int64, error) { return 0, nil }
+func (s stubInbox) GetUndeliveredNotifications(context.Context, uuid.UUID, time.Time, int, int) ([]model.Notification, error) {
+	return s.undelivered, nil
+}
+func (stubInbox) MarkNotificationDelivered(context.Context, uuid.UUID, uuid.UUID) (bool, error) {
+	return true, nil
+}
+func (stubInbox) RecordDeliveryAttempts(context.Context, uuid.UUID, map[uuid.UUID]int) error {
+	return nil
+}
+
+// newReplayClient builds a client without a socket; replay only touches its
+// send queue, the pending list and the inbox
+func newReplayClient(user uuid.UUID, cfg Config) *Client {
+	cfg = cfg.withDefaults()
+	return &Client{
+		ID:        uuid.New(),
+		UserID:    user,
+		SendCh:    make(chan Envelope, 1024),
+		log:       logging.GetLogger(),
+		cfg:       cfg,
+		inflight:  make(map[string]*inflightPush),
+		attempts:  make(map[uuid.UUID]int),
+		done:      make(chan struct{}),
+		inbox:     stubInbox{},
+		replaying: true,
+	}
+}
+
+func drainIDs(c *Client) []string {
+	var ids []string
+	for {
+		select {
+		case env := <-c.SendCh:
+			ids = append(ids, env.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+func TestReplayBacklogWalksEveryPage(t *testing.T) {
+	user := uuid.New()
+	feed := newSliceFeed(user, 2*replayPageSize+7)
+
+	var got []string
+	seen, err := replayBacklog(context.Background(), feed, user, ResumeCursor{After: feed[2].CreatedAt, AfterID: feed[2].ID}, func(env Envelope) bool {
+		got = append(got, env.ID)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(feed)-3 || len(seen) != len(got) {
+		t.Fatalf("replayed %d notifications, want %d", len(got), len(feed)-3)
+	}
+	for i, id := range got {
+		if id != feed[i+3].ID.String() {
+			t.Fatalf("replay out of order at %d", i)
+		}
+	}
+}
+
+func TestReplayFlushesHeldMessagesWithoutDuplicates(t *testing.T) {
+	user := uuid.New()
+	feed := newSliceFeed(user, 3)
+	c := newReplayClient(user, Config{})
+
+	// a live push of a notification the replay also returns, and a newer one
+	dup, _ := notificationEnvelope(&feed[2])
+	fresh := model.Notification{ID: uuid.New(), UserID: user, CreatedAt: time.Now()}
+	live, _ := notificationEnvelope(&fresh)
+	c.Send(dup)
+	c.Send(live)
+
+	c.replay(feed, ResumeCursor{})
+
+	want := []string{feed[0].ID.String(), feed[1].ID.String(), feed[2].ID.String(), fresh.ID.String()}
+	got := drainIDs(c)
+	if len(got) != len(want) {
+		t.Fatalf("delivered %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("delivered %v, want %v", got, want)
+		}
+	}
+	if c.replaying {
+		t.Fatal("client still replaying after the backlog was flushed")
+	}
+}
+
+func TestReplayBoundsHeldMessages(t *testing.T) {
+	user := uuid.New()
+	for _, tc := range []struct {
+		policy  OverflowPolicy
+		keep    []string
+		dropped int
+	}{
+		{OverflowDropOldest, []string{"3", "4"}, 3},
+		{OverflowDropNewest, []string{"0", "1"}, 3},
+	} {
+		c := newReplayClient(user, Config{SendQueueSize: 2, OverflowPolicy: tc.policy})
+		for i := 0; i < 5; i++ {
+			env, _ := NewEnvelope(EventMessage, string(rune('0'+i)), nil)
+			c.Send(env)
+		}
+		var kept []string
+		for _, env := range c.pending {
+			kept = append(kept, env.ID)
+		}
+		if len(kept) != 2 || kept[0] != tc.keep[0] || kept[1] != tc.keep[1] {
+			t.Errorf("%s: held %v, want %v", tc.policy, kept, tc.keep)
+		}
+		if c.dropped != tc.dropped {
+			t.Errorf("%s: counted %d drops, want %d so a resync is requested", tc.policy, c.dropped, tc.dropped)
+		}
+	}
+}
+
+func TestResumeFromDeletedNotification(t *testing.T) {
+	user := uuid.New()
+	feed := newSliceFeed(user, 4)
+	env, _ := notificationEnvelope(&feed[1])
+	// the client saw feed[1], then deleted it before reconnecting
+	remaining := append(feed[:1:1], feed[2:]...)
+
+	for _, tc := range []struct {
+		name  string
+		since string
+		want  []uuid.UUID
+		err   error
+	}{
+		{"event cursor", env.Cursor, []uuid.UUID{feed[2].ID, feed[3].ID}, nil},
+		{"timestamp", feed[1].CreatedAt.Format(time.RFC3339Nano), []uuid.UUID{feed[2].ID, feed[3].ID}, nil},
+		{"deleted id", feed[1].ID.String(), nil, ErrInvalidCursor},
+		{"garbage", "not-a-cursor", nil, ErrInvalidCursor},
+	} {
+		cursor, err := ParseResumeCursor(context.Background(), remaining, user, tc.since)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: got error %v, want %v", tc.name, err, tc.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		var got []uuid.UUID
+		_, err = replayBacklog(context.Background(), remaining, user, *cursor, func(env Envelope) bool {
+			got = append(got, uuid.MustParse(env.ID))
+			return true
+		})
+		if err != nil || len(got) != len(tc.want) || got[0] != tc.want[0] || got[1] != tc.want[1] {
+			t.Errorf("%s: replayed %v, %v, want %v", tc.name, got, err, tc.want)
+		}
+	}
+}
+
+func TestResubscribeRedeliversWithoutDuplicates(t *testing.T) {
+	user := uuid.New()
+	feed := newSliceFeed(user, 4)
+	c := newReplayClient(user, Config{})
+	// feed[0] predates the cursor and feed[3] is replayed anyway; both were
+	// pushed on an earlier connection and never acknowledged
+	c.inbox = stubInbox{sliceFeed: feed, undelivered: []model.Notification{feed[0], feed[3]}}
+
+	c.replay(feed, ResumeCursor{After: feed[1].CreatedAt, AfterID: feed[1].ID})
+	want := []string{feed[2].ID.String(), feed[3].ID.String(), feed[0].ID.String()}
+	if got := drainIDs(c); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("resume delivered %v, want %v", got, want)
+	}
+
+	// a resubscribe without a cursor skips what is still in flight here
+	c.track(Envelope{Type: EventNotificationCreated, ID: feed[0].ID.String()})
+	if !c.redeliver(nil) {
+		t.Fatal("redeliver reported the client gone")
+	}
+	want = []string{feed[3].ID.String()}
+	if got := drainIDs(c); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("resubscribe delivered %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,191 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"net/http"
+	"notificationService/internal/auth"
+	"sync"
+	"time"
+)
+
+// sseRetry tells EventSource how long to wait before reconnecting, in milliseconds.
+const sseRetry = 3000
+
+// sseStream is an SSE connection registered with the hub. The request
+// goroutine is its only writer; Send just queues.
+type sseStream struct {
+	id       uuid.UUID
+	userID   uuid.UUID
+	ch       chan Envelope
+	overflow chan struct{}
+	once     sync.Once
+	stopping chan struct{}
+	stopOnce sync.Once
+	claims   *auth.Claims
+}
+
+func newSSEStream(userID uuid.UUID, queueSize int) *sseStream {
+	return &sseStream{
+		id:       uuid.New(),
+		userID:   userID,
+		ch:       make(chan Envelope, queueSize),
+		overflow: make(chan struct{}),
+		stopping: make(chan struct{}),
+	}
+}
+
+func (s *sseStream) Key() uuid.UUID   { return s.id }
+func (s *sseStream) Owner() uuid.UUID { return s.userID }
+
+func (s *sseStream) currentClaims() *auth.Claims { return s.claims }
+
+// Send queues env; a full queue ends the stream and the client resumes from
+// its last event ID (see HandleSSE), recovering what was dropped from the
+// persisted feed.
+func (s *sseStream) Send(env Envelope) {
+	select {
+	case s.ch <- env:
+	default:
+		metricDroppedMessages.Add(1)
+		s.once.Do(func() { close(s.overflow) })
+	}
+}
+
+// drain ends the stream after what is already queued; EventSource then
+// reconnects to another instance.
+func (s *sseStream) drain() {
+	s.stopOnce.Do(func() { close(s.stopping) })
+}
+
+// HandleSSE streams the same events as /ws over Server-Sent Events for clients
+// whose proxies block WebSocket upgrades. Resume uses the standard
+// Last-Event-ID header (or a `since` query parameter): event IDs are the
+// notification cursors, so the header names the last notification seen and
+// keeps working after that notification is deleted.
+//
+// Tickets are single-use, so when a ticket-authenticated stream drops, the
+// browser's automatic reconnect replays the spent ticket and gets a 401,
+// which closes the EventSource. Such clients must mint a new ticket and open
+// a new EventSource, passing the last event ID as `since`, because a fresh
+// EventSource does not send Last-Event-ID.
+func HandleSSE(inbox InboxService, cfg Config) gin.HandlerFunc {
+	cfg = cfg.withDefaults()
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user_id missing in context"})
+			return
+		}
+		uid := userID.(uuid.UUID)
+
+		since := c.GetHeader("Last-Event-ID")
+		if since == "" {
+			since = c.Query("since")
+		}
+		var cursor *ResumeCursor
+		if since != "" {
+			parsed, err := ParseResumeCursor(c, inbox, uid, since)
+			if err != nil {
+				if errors.Is(err, ErrInvalidCursor) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			cursor = parsed
+		}
+
+		stream := newSSEStream(uid, cfg.SendQueueSize)
+		if claims, ok := c.Get("claims"); ok {
+			stream.claims = claims.(*auth.Claims)
+		}
+		if err := RegisterLimited(stream, cfg.MaxConnectionsPerUser); err != nil {
+			if errors.Is(err, errDraining) {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+				return
+			}
+			metricConnectionLimited.Add(1)
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("connection limit reached (max %d per user)", cfg.MaxConnectionsPerUser)})
+			return
+		}
+		defer Unregister(stream)
+
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		c.Render(-1, sse.Event{Event: "open", Retry: sseRetry, Data: uid.String()})
+		c.Writer.Flush()
+
+		// live events queue in the stream while the backlog is written, so
+		// the boundary has no gaps; duplicates are skipped below
+		var seen map[uuid.UUID]struct{}
+		if cursor != nil {
+			var err error
+			seen, err = replayBacklog(c.Request.Context(), inbox, uid, *cursor, func(env Envelope) bool {
+				writeSSE(c, env)
+				return c.Request.Context().Err() == nil
+			})
+			if err != nil {
+				c.Error(err)
+			}
+		}
+
+		keepAlive := time.NewTicker(cfg.PingInterval)
+		defer keepAlive.Stop()
+
+		// end the stream when the token expires; EventSource reconnects and
+		// has to present fresh credentials
+		var expired <-chan time.Time
+		if claims, ok := c.Get("claims"); ok {
+			if exp := claims.(*auth.Claims).ExpiresAt; !exp.IsZero() {
+				timer := time.NewTimer(time.Until(exp))
+				defer timer.Stop()
+				expired = timer.C
+			}
+		}
+
+		for {
+			select {
+			case env := <-stream.ch:
+				if isReplayed(env, seen) {
+					continue
+				}
+				writeSSE(c, env)
+			case <-keepAlive.C:
+				_, _ = c.Writer.WriteString(": keep-alive\n\n")
+				c.Writer.Flush()
+			case <-stream.overflow:
+				return
+			case <-stream.stopping:
+				for {
+					select {
+					case env := <-stream.ch:
+						if !isReplayed(env, seen) {
+							writeSSE(c, env)
+						}
+					default:
+						return
+					}
+				}
+			case <-expired:
+				metricExpiredSessions.Add(1)
+				return
+			case <-c.Request.Context().Done():
+				return
+			}
+		}
+	}
+}
+
+// writeSSE renders env as one SSE event; only notifications carry a cursor,
+// so Last-Event-ID always points at a notification.
+func writeSSE(c *gin.Context, env Envelope) {
+	c.Render(-1, sse.Event{Event: env.Type, Id: env.Cursor, Data: env})
+	c.Writer.Flush()
+}
@@ -0,0 +1,75 @@
+package ws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"notificationService/internal/auth"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestSSEResumesAndRejectsSpentTickets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	user := uuid.New()
+	feed := newSliceFeed(user, 3)
+	store, _ := newTicketStore(t)
+	r := gin.New()
+	r.GET("/events", auth.Authenticate(nil, handshakeCredentials(nil, store)), HandleSSE(stubInbox{sliceFeed: feed}, Config{}))
+
+	// the stream ends on its own once the ticket's token expires
+	issue := func() string {
+		ticket, err := store.Issue(context.Background(), &auth.Claims{UserID: user, ExpiresAt: time.Now().Add(50 * time.Millisecond)}, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ticket
+	}
+	first, _ := notificationEnvelope(&feed[0])
+	reused := issue()
+
+	for _, tc := range []struct {
+		name      string
+		ticket    string
+		lastEvent string
+		since     string
+		code      int
+		events    []int
+	}{
+		{"whole backlog from a timestamp", reused, "", feed[0].CreatedAt.Add(-time.Second).Format(time.RFC3339Nano), http.StatusOK, []int{0, 1, 2}},
+		{"spent ticket on reconnect", reused, first.Cursor, "", http.StatusUnauthorized, nil},
+		{"resume from Last-Event-ID", issue(), first.Cursor, "", http.StatusOK, []int{1, 2}},
+		{"resume from since", issue(), "", first.Cursor, http.StatusOK, []int{1, 2}},
+		{"Last-Event-ID wins over since", issue(), first.Cursor, feed[2].ID.String(), http.StatusOK, []int{1, 2}},
+		{"invalid cursor", issue(), "", "garbage", http.StatusBadRequest, nil},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/events?ticket="+tc.ticket+"&since="+tc.since, nil)
+		if tc.lastEvent != "" {
+			req.Header.Set("Last-Event-ID", tc.lastEvent)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Errorf("%s: got %d, want %d", tc.name, w.Code, tc.code)
+			continue
+		}
+		var want []string
+		for _, i := range tc.events {
+			env, _ := notificationEnvelope(&feed[i])
+			want = append(want, "id:"+env.Cursor)
+		}
+		var got []string
+		for _, line := range strings.Split(w.Body.String(), "\n") {
+			if strings.HasPrefix(line, "id:") {
+				got = append(got, line)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("%s: streamed ids %v, want %v", tc.name, got, want)
+		}
+	}
+}
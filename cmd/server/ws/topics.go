@@ -0,0 +1,138 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Sayan80bayev/go-project/pkg/logging"
+	"github.com/Sayan80bayev/go-project/pkg/middleware"
+	"notificationService/internal/auth"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidTopic   = errors.New("invalid topic name")
+	ErrTopicForbidden = errors.New("not allowed to join topic")
+)
+
+// Topics are "<kind>:<key>", e.g. "post:3f0c…" or "group:42:announcements".
+var topicPattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}:[A-Za-z0-9_.:-]{1,128}$`)
+
+// ValidTopic reports whether topic is a well-formed topic name.
+func ValidTopic(topic string) bool {
+	return topicPattern.MatchString(topic)
+}
+
+// TopicAuthorizer decides whether the holder of claims may join topic.
+type TopicAuthorizer interface {
+	AuthorizeTopic(ctx context.Context, claims *auth.Claims, topic string) error
+}
+
+// TopicRule authorizes one kind of topic; key is the part after the kind.
+type TopicRule func(ctx context.Context, claims *auth.Claims, key string) error
+
+// AllowAuthenticated lets any signed-in user join.
+func AllowAuthenticated(context.Context, *auth.Claims, string) error {
+	return nil
+}
+
+// RequireRoles lets users holding any of roles join.
+func RequireRoles(roles ...middleware.Role) TopicRule {
+	return func(_ context.Context, claims *auth.Claims, _ string) error {
+		if claims.HasRole(roles...) {
+			return nil
+		}
+		return ErrTopicForbidden
+	}
+}
+
+// TopicPolicy routes authorization by topic kind; kinds without a rule are denied.
+type TopicPolicy struct {
+	rules map[string]TopicRule
+}
+
+func NewTopicPolicy() *TopicPolicy {
+	return &TopicPolicy{rules: make(map[string]TopicRule)}
+}
+
+// Allow registers the rule for topics of kind.
+func (p *TopicPolicy) Allow(kind string, rule TopicRule) *TopicPolicy {
+	p.rules[kind] = rule
+	return p
+}
+
+func (p *TopicPolicy) AuthorizeTopic(ctx context.Context, claims *auth.Claims, topic string) error {
+	kind, key, _ := strings.Cut(topic, ":")
+	rule, ok := p.rules[kind]
+	if !ok {
+		return ErrTopicForbidden
+	}
+	return rule(ctx, claims, key)
+}
+
+// UseTopicAuthorizer installs the join hook. Without one every join is refused.
+func UseTopicAuthorizer(a TopicAuthorizer) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	hub.topicAuth = a
+}
+
+// PublishTopic pushes a typed event to every socket that joined topic, on
+// any instance.
+func PublishTopic(topic, eventType, id string, payload interface{}) error {
+	if !ValidTopic(topic) {
+		return ErrInvalidTopic
+	}
+	env, err := NewEnvelope(eventType, id, payload)
+	if err != nil {
+		logging.GetLogger().Errorf("error marshalling %s event for topic %s: %v", eventType, topic, err)
+		return err
+	}
+	env.Topic = topic
+	hub.PublishTopic(topic, env)
+	return nil
+}
+
+// joinTopics authorizes every topic before joining any, and leaves the ones
+// joined here again if a later join fails.
+func (c *Client) joinTopics(ctx context.Context, topics []string) error {
+	hub.mu.RLock()
+	authz := hub.topicAuth
+	hub.mu.RUnlock()
+
+	c.mu.Lock()
+	claims := c.claims
+	c.mu.Unlock()
+
+	for _, topic := range topics {
+		if !ValidTopic(topic) {
+			return fmt.Errorf("%w: %q", ErrInvalidTopic, topic)
+		}
+		if authz == nil || claims == nil {
+			return fmt.Errorf("%w: %s", ErrTopicForbidden, topic)
+		}
+		if err := authz.AuthorizeTopic(ctx, claims, topic); err != nil {
+			if errors.Is(err, ErrTopicForbidden) {
+				return fmt.Errorf("%w: %s", ErrTopicForbidden, topic)
+			}
+			return err
+		}
+	}
+
+	for i, topic := range topics {
+		if err := hub.Join(c, topic); err != nil {
+			for _, joined := range topics[:i] {
+				hub.Leave(c, joined)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) leaveTopics(topics []string) {
+	for _, topic := range topics {
+		hub.Leave(c, topic)
+	}
+}
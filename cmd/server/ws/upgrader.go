@@ -0,0 +1,69 @@
+package ws
+
+import (
+	"github.com/Sayan80bayev/go-project/pkg/logging"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// newUpgrader builds the handshake policy from cfg. Rejected upgrades are
+// logged and counted; gorilla has already written the HTTP error by then.
+func newUpgrader(cfg Config) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:    cfg.ReadBufferSize,
+		WriteBufferSize:   cfg.WriteBufferSize,
+		EnableCompression: cfg.EnableCompression,
+		Subprotocols:      withCodecProtocols(cfg.Subprotocols),
+		CheckOrigin:       originChecker(cfg.AllowedOrigins),
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			metricRejectedUpgrades.Add(1)
+			logging.GetLogger().Warnf("websocket upgrade rejected: status=%d origin=%q remote=%s: %v",
+				status, r.Header.Get("Origin"), r.RemoteAddr, reason)
+			http.Error(w, http.StatusText(status), status)
+		},
+	}
+}
+
+// originChecker guards against cross-site WebSocket hijacking. Requests
+// without an Origin header come from non-browser clients and pass. With an
+// empty allowlist only same-origin requests are accepted. Entries are full
+// origins ("https://app.example.com"), "https://*.example.com" for any
+// subdomain, or "*" to allow everything.
+func originChecker(allowed []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Host == "" {
+			return false
+		}
+		if len(allowed) == 0 {
+			return strings.EqualFold(u.Host, r.Host)
+		}
+		for _, a := range allowed {
+			if originAllowed(strings.TrimSpace(a), u) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func originAllowed(pattern string, origin *url.URL) bool {
+	if pattern == "*" {
+		return true
+	}
+	p, err := url.Parse(pattern)
+	if err != nil || !strings.EqualFold(p.Scheme, origin.Scheme) {
+		return false
+	}
+	if suffix, ok := strings.CutPrefix(p.Host, "*."); ok {
+		host := strings.ToLower(origin.Host)
+		return strings.HasSuffix(host, "."+strings.ToLower(suffix))
+	}
+	return strings.EqualFold(p.Host, origin.Host)
+}
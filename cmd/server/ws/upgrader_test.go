@@ -0,0 +1,40 @@
+package ws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOriginChecker(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{"no origin header", []string{"https://app.example.com"}, "", true},
+		{"malformed origin", nil, "://bad", false},
+		{"origin without host", nil, "null", false},
+		{"same origin by default", nil, "https://notify.example.com", true},
+		{"cross origin by default", nil, "https://evil.example.net", false},
+		{"exact match", []string{"https://app.example.com"}, "https://app.example.com", true},
+		{"case-insensitive host", []string{"https://App.Example.com"}, "https://app.example.com", true},
+		{"scheme mismatch", []string{"https://app.example.com"}, "http://app.example.com", false},
+		{"port mismatch", []string{"https://app.example.com"}, "https://app.example.com:8443", false},
+		{"padded entry", []string{" https://app.example.com "}, "https://app.example.com", true},
+		{"any subdomain", []string{"https://*.example.com"}, "https://a.b.example.com", true},
+		{"wildcard skips the apex", []string{"https://*.example.com"}, "https://example.com", false},
+		{"wildcard suffix is a label", []string{"https://*.example.com"}, "https://evilexample.com", false},
+		{"later entry", []string{"https://app.example.com", "https://admin.example.com"}, "https://admin.example.com", true},
+		{"allow everything", []string{"*"}, "https://anything.test", true},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "http://notify.example.com/ws", nil)
+		if tc.origin != "" {
+			r.Header.Set("Origin", tc.origin)
+		}
+		if got := originChecker(tc.allowed)(r); got != tc.want {
+			t.Errorf("%s: allowed=%v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"errors"
+	"github.com/Sayan80bayev/go-project/pkg/middleware"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+var errMissingToken = errors.New("missing or invalid token")
+
+// CredentialSource extracts claims from a request that has no Authorization
+// header. It returns nil claims and a nil error when the request carries no
+// credential of its kind, so the next source is tried.
+type CredentialSource func(c *gin.Context) (*Claims, error)
+
+// Authenticate verifies the Authorization bearer token and, when the header
+// is absent, tries each source in order. It sets the same context keys as
+// middleware.AuthMiddleware plus "claims".
+func Authenticate(verifier *Verifier, sources ...CredentialSource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := credentials(c, verifier, sources)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set("user_id", claims.UserID)
+		if claims.Username != "" {
+			c.Set("username", claims.Username)
+		}
+		c.Set("roles", claims.Roles)
+		c.Set("claims", claims)
+		c.Next()
+	}
+}
+
+func credentials(c *gin.Context, verifier *Verifier, sources []CredentialSource) (*Claims, error) {
+	if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return verifier.Verify(strings.TrimPrefix(header, "Bearer "))
+	}
+	for _, source := range sources {
+		claims, err := source(c)
+		if err != nil {
+			return nil, err
+		}
+		if claims != nil {
+			return claims, nil
+		}
+	}
+	return nil, errMissingToken
+}
+
+// RequireRoles lets the request through when the authenticated caller holds
+// any of roles. It reads the "roles" context key set by Authenticate, so it
+// must run after it.
+func RequireRoles(roles ...middleware.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		val, exists := c.Get("roles")
+		if !exists {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient role"})
+			return
+		}
+		have, _ := val.([]middleware.Role)
+		claims := Claims{Roles: have}
+		if !claims.HasRole(roles...) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient role"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireServiceAccount admits only client-credentials tokens that carry grant
+// as a role or scope. It reads the "claims" context key set by Authenticate,
+// so it must run after it.
+func RequireServiceAccount(grant string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		val, _ := c.Get("claims")
+		claims, ok := val.(*Claims)
+		if !ok || !claims.ServiceAccount || !claims.HasGrant(grant) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "service account with " + grant + " required"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestAuthenticateTriesSourcesInOrder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	user := uuid.New()
+	none := func(*gin.Context) (*Claims, error) { return nil, nil }
+	found := func(*gin.Context) (*Claims, error) { return &Claims{UserID: user}, nil }
+	bad := func(*gin.Context) (*Claims, error) { return nil, errors.New("invalid or expired ticket") }
+
+	for _, tc := range []struct {
+		name    string
+		sources []CredentialSource
+		want    int
+	}{
+		{"no sources", nil, http.StatusUnauthorized},
+		{"nothing found", []CredentialSource{none, none}, http.StatusUnauthorized},
+		{"later source", []CredentialSource{none, found}, http.StatusOK},
+		{"error stops the chain", []CredentialSource{bad, found}, http.StatusUnauthorized},
+	} {
+		r := gin.New()
+		r.GET("/", Authenticate(nil, tc.sources...), func(c *gin.Context) {
+			if got, _ := c.Get("user_id"); got != user {
+				t.Errorf("%s: user_id is %v, want %s", tc.name, got, user)
+			}
+			c.Status(http.StatusOK)
+		})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, w.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MicahParks/keyfunc/v2"
+	"github.com/Sayan80bayev/go-project/pkg/middleware"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken  = errors.New("invalid token")
+	ErrInvalidClaims = errors.New("invalid token claims")
+)
+
+// Claims is what the service needs from a verified Keycloak access token.
+type Claims struct {
+	UserID    uuid.UUID         `json:"user_id"`
+	Username  string            `json:"username,omitempty"`
+	Roles     []middleware.Role `json:"roles,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+
+	// ClientID is the client the token was issued to (azp)
+	ClientID string `json:"client_id,omitempty"`
+	// ServiceAccount marks client-credentials tokens; see isServiceAccount
+	ServiceAccount bool `json:"service_account,omitempty"`
+	// Grants holds the raw realm roles, client roles of every client and
+	// scopes, which service accounts are authorized by
+	Grants []string `json:"grants,omitempty"`
+}
+
+// HasRole reports whether the claims carry any of roles.
+func (c *Claims) HasRole(roles ...middleware.Role) bool {
+	for _, have := range c.Roles {
+		for _, want := range roles {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasGrant reports whether the claims carry grant as a role or scope.
+func (c *Claims) HasGrant(grant string) bool {
+	for _, have := range c.Grants {
+		if have == grant {
+			return true
+		}
+	}
+	return false
+}
+
+// Verifier validates access tokens against the realm's JWKS. Authenticate
+// uses it for the REST routes and the WebSocket, SSE and poll endpoints alike.
+type Verifier struct {
+	jwks *keyfunc.JWKS
+}
+
+func NewVerifier(jwksURL string) (*Verifier, error) {
+	jwks, err := keyfunc.Get(jwksURL, keyfunc.Options{
+		RefreshUnknownKID: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not load JWKS: %w", err)
+	}
+	return &Verifier{jwks: jwks}, nil
+}
+
+// Verify checks the signature and expiry of tokenString and extracts its claims
+func (v *Verifier) Verify(tokenString string) (*Claims, error) {
+	token, err := jwt.Parse(tokenString, v.jwks.Keyfunc)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	mc, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidClaims
+	}
+
+	sub, _ := mc["sub"].(string)
+	userID, err := uuid.Parse(sub)
+	if err != nil {
+		return nil, ErrInvalidClaims
+	}
+	claims := &Claims{UserID: userID}
+
+	if exp, err := mc.GetExpirationTime(); err == nil && exp != nil {
+		claims.ExpiresAt = exp.Time
+	}
+	if username, ok := mc["preferred_username"].(string); ok {
+		claims.Username = username
+	}
+	claims.Roles = rolesFrom(mc)
+	claims.ClientID, _ = mc["azp"].(string)
+	claims.ServiceAccount = isServiceAccount(mc)
+	claims.Grants = grantsFrom(mc)
+	return claims, nil
+}
+
+// isServiceAccount recognises client-credentials tokens by their claims rather
+// than by username, which users may be able to choose. Keycloak stamps those
+// tokens with the client_id (clientId before Keycloak 24) of the client that
+// authenticated and, having no browser login behind them, no user session.
+func isServiceAccount(mc jwt.MapClaims) bool {
+	if _, ok := mc["sid"]; ok {
+		return false
+	}
+	if _, ok := mc["session_state"]; ok {
+		return false
+	}
+	for _, key := range []string{"client_id", "clientId"} {
+		if id, _ := mc[key].(string); id != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// grantsFrom collects realm roles, every client's roles and the space-separated scope claim
+func grantsFrom(mc jwt.MapClaims) []string {
+	var grants []string
+	appendRoles := func(access interface{}) {
+		m, ok := access.(map[string]interface{})
+		if !ok {
+			return
+		}
+		raw, _ := m["roles"].([]interface{})
+		for _, role := range raw {
+			if r, ok := role.(string); ok {
+				grants = append(grants, r)
+			}
+		}
+	}
+	appendRoles(mc["realm_access"])
+	if resourceAccess, ok := mc["resource_access"].(map[string]interface{}); ok {
+		for _, access := range resourceAccess {
+			appendRoles(access)
+		}
+	}
+	if scope, ok := mc["scope"].(string); ok {
+		grants = append(grants, strings.Fields(scope)...)
+	}
+	return grants
+}
+
+// rolesFrom maps Keycloak client roles to app roles the same way the shared middleware does
+func rolesFrom(mc jwt.MapClaims) []middleware.Role {
+	resourceAccess, ok := mc["resource_access"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	authService, ok := resourceAccess["auth_service"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	raw, ok := authService["roles"].([]interface{})
+	if !ok {
+		return nil
+	}
+	var roles []middleware.Role
+	for _, role := range raw {
+		r, ok := role.(string)
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(r) {
+		case "admin":
+			roles = append(roles, middleware.RoleAdmin)
+		case "moder":
+			roles = append(roles, middleware.RoleModerator)
+		case "user":
+			roles = append(roles, middleware.RoleUser)
+		}
+	}
+	return roles
+}
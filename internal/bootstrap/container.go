@@ -8,6 +8,9 @@ import (
 	"github.com/Sayan80bayev/go-project/pkg/logging"
 	"github.com/Sayan80bayev/go-project/pkg/messaging"
 	_ "github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+	"notificationService/cmd/server/ws"
+	"notificationService/internal/auth"
 	"notificationService/internal/config"
 	"notificationService/internal/events"
 	ms "notificationService/internal/messaging"
@@ -20,11 +23,19 @@ import (
 type Container struct {
 	DB                     *sql.DB
 	Redis                  caching.CacheService
+	RedisClient            *redis.Client
 	Producer               messaging.Producer
 	Consumer               messaging.Consumer
 	Config                 *config.Config
 	NotificationService    service.NotificationService
 	NotificationRepository repository.NotificationRepository
+	Backplane              ws.Backplane
+	Presence               *ws.Presence
+	Tickets                ws.TicketStore
+	RateLimiter            ws.RateLimiter
+	TopicAuthorizer        ws.TopicAuthorizer
+	Verifier               *auth.Verifier
+	WSConfig               ws.Config
 	JWKSUrl                string
 }
 
@@ -47,24 +58,54 @@ func Init() (*Container, error) {
 		return nil, err
 	}
 
+	redisClient, err := initRedisClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	nr := repository.NewNotificationRepository(db)
-	svc := service.NewNotificationService(nr)
+	unread := repository.NewRedisUnreadCounter(redisClient, cfg.UnreadCacheTTL)
+	svc := service.NewNotificationService(nr, unread)
 
 	consumer, err := initRabbitMQConsumer(cfg, svc)
 	if err != nil {
 		return nil, err
 	}
 
+	producer, err := initRabbitMQProducer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	backplane := initBackplane(cfg, redisClient)
+	presence := initPresence(cfg, redisClient, producer)
+
 	jwksURL := buildJWKSURL(cfg)
 
+	verifier, err := auth.NewVerifier(jwksURL)
+	if err != nil {
+		return nil, err
+	}
+
+	wsConfig := buildWSConfig(cfg)
+
 	logger.Info("Dependencies initialized successfully")
 
 	return &Container{
 		DB:                     db,
 		Redis:                  cacheService,
+		RedisClient:            redisClient,
+		Producer:               producer,
 		Consumer:               consumer,
 		NotificationService:    svc,
 		NotificationRepository: nr,
+		Backplane:              backplane,
+		Presence:               presence,
+		Tickets:                ws.NewRedisTicketStore(redisClient),
+		RateLimiter:            ws.NewRedisRateLimiter(redisClient, wsConfig.HandshakeRateLimit, wsConfig.HandshakeRateWindow),
+		TopicAuthorizer:        buildTopicPolicy(),
+		Verifier:               verifier,
+		WSConfig:               wsConfig,
 		Config:                 cfg,
 		JWKSUrl:                jwksURL,
 	}, nil
@@ -109,6 +150,54 @@ func initRedis(cfg *config.Config) (*caching.RedisService, error) {
 	return redisCache, nil
 }
 
+// initRedisClient opens a plain client for the atomic counters CacheService does not expose
+func initRedisClient(cfg *config.Config) (*redis.Client, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.RedisAddr,
+		Password: cfg.RedisPass,
+		DB:       0,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("redis client connection failed: %w", err)
+	}
+	return client, nil
+}
+
+// initBackplane picks the hub backplane; Redis is required once more than one replica runs
+func initBackplane(cfg *config.Config, client *redis.Client) ws.Backplane {
+	logger := logging.GetLogger()
+	switch cfg.WSBackplane {
+	case "memory":
+		logger.Info("Using in-memory hub backplane")
+		return ws.NewMemoryBackplane()
+	default:
+		logger.Info("Using Redis hub backplane")
+		return ws.NewRedisBackplane(client)
+	}
+}
+
+// initPresence keeps presence in-process alongside the memory backplane and in Redis otherwise
+func initPresence(cfg *config.Config, client *redis.Client, producer messaging.Producer) *ws.Presence {
+	if cfg.WSBackplane == "memory" {
+		return ws.NewPresence(ws.NewMemoryPresenceStore(), producer)
+	}
+	return ws.NewPresence(ws.NewRedisPresenceStore(client), producer)
+}
+
+func initRabbitMQProducer(cfg *config.Config) (messaging.Producer, error) {
+	if cfg.RabbitMQPresenceExchange == cfg.RabbitMQExchange {
+		return nil, fmt.Errorf("RABBIT_MQ_PRESENCE_EXCHANGE must differ from RABBIT_MQ_EXCHANGE (%s)", cfg.RabbitMQExchange)
+	}
+	producer, err := ms.NewRabbitProducer(buildAmqpURL(cfg), cfg.RabbitMQPresenceExchange, logging.GetLogger())
+	if err != nil {
+		return nil, fmt.Errorf("rabbitmq producer init failed: %w", err)
+	}
+	return producer, nil
+}
+
 func initRabbitMQConsumer(cfg *config.Config, svc service.NotificationService) (messaging.Consumer, error) {
 	amqpUrl := buildAmqpURL(cfg)
 	consumer, err := ms.NewRabbitConsumer(amqpUrl, cfg.RabbitMQExchange, cfg.RabbitMQQueue, cfg.RabbitMQRoutingKey, logging.GetLogger())
@@ -121,6 +210,42 @@ func initRabbitMQConsumer(cfg *config.Config, svc service.NotificationService) (
 	return consumer, nil
 }
 
+func buildWSConfig(cfg *config.Config) ws.Config {
+	return ws.Config{
+		PingInterval:   cfg.WSPingInterval,
+		PongWait:       cfg.WSPongWait,
+		MaxMessageSize: cfg.WSMaxMessageSize,
+		SendQueueSize:  cfg.WSSendQueueSize,
+		OverflowPolicy: ws.OverflowPolicy(cfg.WSOverflowPolicy),
+
+		AckTimeout:          cfg.WSAckTimeout,
+		MaxDeliveryAttempts: cfg.WSMaxDeliveryAttempts,
+		DeliveryRetryWindow: cfg.WSDeliveryRetryWindow,
+
+		AllowedOrigins:    cfg.WSAllowedOrigins,
+		ReadBufferSize:    cfg.WSReadBufferSize,
+		WriteBufferSize:   cfg.WSWriteBufferSize,
+		EnableCompression: cfg.WSEnableCompression,
+		Subprotocols:      cfg.WSSubprotocols,
+
+		TicketTTL:  cfg.WSTicketTTL,
+		ReauthLead: cfg.WSReauthLead,
+
+		MaxConnectionsPerUser: cfg.WSMaxConnectionsPerUser,
+		HandshakeRateLimit:    cfg.WSHandshakeRateLimit,
+		HandshakeRateWindow:   cfg.WSHandshakeRateWindow,
+
+		PresenceGrant: cfg.ServicePresenceGrant,
+	}
+}
+
+// buildTopicPolicy lists the topic kinds sockets may join; any other kind is refused
+func buildTopicPolicy() ws.TopicAuthorizer {
+	return ws.NewTopicPolicy().
+		// post:<post_id> carries a post's public comment stream
+		Allow("post", ws.AllowAuthenticated)
+}
+
 func buildJWKSURL(cfg *config.Config) string {
 	return fmt.Sprintf("%s/realms/%s/protocol/openid-connect/certs", cfg.KeycloakURL, cfg.KeycloakRealm)
 }
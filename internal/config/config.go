@@ -3,13 +3,53 @@ package config
 import (
 	"github.com/Sayan80bayev/go-project/pkg/logging"
 	"github.com/spf13/viper"
+	"time"
 )
 
 type Config struct {
 	Port string `mapstructure:"PORT"`
+	// ShutdownTimeout bounds draining sockets and in-flight requests on SIGTERM
+	ShutdownTimeout time.Duration `mapstructure:"SHUTDOWN_TIMEOUT"`
+	// MetricsAddr is the internal listener for /debug/vars; empty disables it.
+	// It must not be reachable from outside the cluster.
+	MetricsAddr string `mapstructure:"METRICS_ADDR"`
+	// TrustedProxies lists the proxy IPs or CIDRs whose X-Forwarded-For is
+	// believed; empty trusts none, so client IPs come from the socket peer
+	TrustedProxies []string `mapstructure:"TRUSTED_PROXIES"`
 
 	RedisAddr string `mapstructure:"REDIS_ADDR"`
 	RedisPass string `mapstructure:"REDIS_PASS"`
+	// UnreadCacheTTL bounds how long cached unread counters live before they are recounted
+	UnreadCacheTTL time.Duration `mapstructure:"UNREAD_CACHE_TTL"`
+
+	// WSBackplane selects how hub messages reach other instances: "redis" (default) or "memory"
+	WSBackplane string `mapstructure:"WS_BACKPLANE"`
+
+	WSPingInterval   time.Duration `mapstructure:"WS_PING_INTERVAL"`
+	WSPongWait       time.Duration `mapstructure:"WS_PONG_WAIT"`
+	WSMaxMessageSize int64         `mapstructure:"WS_MAX_MESSAGE_SIZE"`
+	WSSendQueueSize  int           `mapstructure:"WS_SEND_QUEUE_SIZE"`
+	WSOverflowPolicy string        `mapstructure:"WS_OVERFLOW_POLICY"`
+
+	WSAckTimeout          time.Duration `mapstructure:"WS_ACK_TIMEOUT"`
+	WSMaxDeliveryAttempts int           `mapstructure:"WS_MAX_DELIVERY_ATTEMPTS"`
+	WSDeliveryRetryWindow time.Duration `mapstructure:"WS_DELIVERY_RETRY_WINDOW"`
+
+	// comma-separated in the environment
+	WSAllowedOrigins    []string `mapstructure:"WS_ALLOWED_ORIGINS"`
+	WSReadBufferSize    int      `mapstructure:"WS_READ_BUFFER_SIZE"`
+	WSWriteBufferSize   int      `mapstructure:"WS_WRITE_BUFFER_SIZE"`
+	WSEnableCompression bool     `mapstructure:"WS_ENABLE_COMPRESSION"`
+	WSSubprotocols      []string `mapstructure:"WS_SUBPROTOCOLS"`
+
+	WSTicketTTL  time.Duration `mapstructure:"WS_TICKET_TTL"`
+	WSReauthLead time.Duration `mapstructure:"WS_REAUTH_LEAD"`
+
+	// WSMaxConnectionsPerUser is enforced by each instance on its own, so
+	// behind N replicas a user may hold up to N times as many connections
+	WSMaxConnectionsPerUser int           `mapstructure:"WS_MAX_CONNECTIONS_PER_USER"`
+	WSHandshakeRateLimit    int           `mapstructure:"WS_HANDSHAKE_RATE_LIMIT"`
+	WSHandshakeRateWindow   time.Duration `mapstructure:"WS_HANDSHAKE_RATE_WINDOW"`
 
 	RabbitMQUser       string `mapstructure:"RABBIT_MQ_USER"`
 	RabbitMQPassword   string `mapstructure:"RABBIT_MQ_PASSWORD"`
@@ -19,9 +59,16 @@ type Config struct {
 	RabbitMQQueue      string `mapstructure:"RABBIT_MQ_QUEUE"`
 	RabbitMQExchange   string `mapstructure:"RABBIT_MQ_EXCHANGE"`
 	RabbitMQRoutingKey string `mapstructure:"RABBIT_MQ_ROUTING_KEY"`
+	// RabbitMQPresenceExchange receives presence.changed; it must differ from
+	// RabbitMQExchange so the consumer never reads the service's own events
+	RabbitMQPresenceExchange string `mapstructure:"RABBIT_MQ_PRESENCE_EXCHANGE"`
 
 	KeycloakURL   string `mapstructure:"KEYCLOAK_URL"`
 	KeycloakRealm string `mapstructure:"KEYCLOAK_REALM"`
+	// ServicePushGrant is the role or scope a service account needs to push through /ws/message
+	ServicePushGrant string `mapstructure:"SERVICE_PUSH_GRANT"`
+	// ServicePresenceGrant is the role or scope a service account needs to query /presence
+	ServicePresenceGrant string `mapstructure:"SERVICE_PRESENCE_GRANT"`
 
 	PostgresHost     string `mapstructure:"POSTGRES_HOST"`
 	PostgresPort     string `mapstructure:"POSTGRES_PORT"`
@@ -34,6 +81,34 @@ func LoadConfig() (*Config, error) {
 	viper.SetConfigFile("config/config.yaml")
 	viper.AutomaticEnv()
 
+	// optional settings are not listed in config.yaml; defaults make them
+	// known to viper so they can still be overridden from the environment
+	viper.SetDefault("SHUTDOWN_TIMEOUT", "25s")
+	viper.SetDefault("METRICS_ADDR", "127.0.0.1:9090")
+	viper.SetDefault("TRUSTED_PROXIES", "")
+	viper.SetDefault("UNREAD_CACHE_TTL", "10m")
+	viper.SetDefault("WS_PING_INTERVAL", "54s")
+	viper.SetDefault("WS_PONG_WAIT", "60s")
+	viper.SetDefault("WS_MAX_MESSAGE_SIZE", 4096)
+	viper.SetDefault("WS_SEND_QUEUE_SIZE", 64)
+	viper.SetDefault("WS_OVERFLOW_POLICY", "drop-oldest")
+	viper.SetDefault("WS_ACK_TIMEOUT", "15s")
+	viper.SetDefault("WS_MAX_DELIVERY_ATTEMPTS", 5)
+	viper.SetDefault("WS_DELIVERY_RETRY_WINDOW", "24h")
+	viper.SetDefault("WS_ALLOWED_ORIGINS", "")
+	viper.SetDefault("WS_READ_BUFFER_SIZE", 1024)
+	viper.SetDefault("WS_WRITE_BUFFER_SIZE", 1024)
+	viper.SetDefault("WS_ENABLE_COMPRESSION", false)
+	viper.SetDefault("WS_SUBPROTOCOLS", "")
+	viper.SetDefault("WS_TICKET_TTL", "30s")
+	viper.SetDefault("WS_REAUTH_LEAD", "60s")
+	viper.SetDefault("WS_MAX_CONNECTIONS_PER_USER", 10)
+	viper.SetDefault("WS_HANDSHAKE_RATE_LIMIT", 30)
+	viper.SetDefault("WS_HANDSHAKE_RATE_WINDOW", "1m")
+	viper.SetDefault("SERVICE_PUSH_GRANT", "notifications:push")
+	viper.SetDefault("SERVICE_PRESENCE_GRANT", "notifications:presence")
+	viper.SetDefault("RABBIT_MQ_PRESENCE_EXCHANGE", "presence")
+
 	if err := viper.ReadInConfig(); err != nil {
 		logging.Instance.Errorf("Couldn't load config.yaml: %v", err)
 	}
@@ -0,0 +1,131 @@
+package delivery
+
+import (
+	"fmt"
+	"notificationService/internal/model"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxFilterValues bounds each comma-separated list filter
+	maxFilterValues = 20
+	maxCategoryLen  = 50
+)
+
+// parseNotificationFilter validates the feed query parameters:
+//
+//	read=true|false
+//	type=follow,system          registered types only
+//	category=social,system
+//	priority=high,urgent
+//	actor_id=<uuid>
+//	created_from=<RFC3339>      inclusive
+//	created_to=<RFC3339>        exclusive
+//	sort=desc|asc               by created_at, newest first by default
+func parseNotificationFilter(c *gin.Context) (model.NotificationFilter, error) {
+	var f model.NotificationFilter
+
+	if raw := c.Query("read"); raw != "" {
+		read, err := strconv.ParseBool(raw)
+		if err != nil {
+			return f, fmt.Errorf("read must be true or false")
+		}
+		f.Read = &read
+	}
+
+	types, err := listParam(c, "type")
+	if err != nil {
+		return f, err
+	}
+	for _, raw := range types {
+		t := model.NotificationType(raw)
+		if !t.Valid() {
+			return f, fmt.Errorf("unknown notification type %q", raw)
+		}
+		f.Types = append(f.Types, t)
+	}
+
+	if f.Categories, err = listParam(c, "category"); err != nil {
+		return f, err
+	}
+	for _, category := range f.Categories {
+		if len(category) > maxCategoryLen {
+			return f, fmt.Errorf("category is longer than %d characters", maxCategoryLen)
+		}
+	}
+
+	priorities, err := listParam(c, "priority")
+	if err != nil {
+		return f, err
+	}
+	for _, raw := range priorities {
+		p := model.Priority(raw)
+		if !p.Valid() {
+			return f, fmt.Errorf("unknown priority %q", raw)
+		}
+		f.Priorities = append(f.Priorities, p)
+	}
+
+	if raw := c.Query("actor_id"); raw != "" {
+		actorID, err := uuid.Parse(raw)
+		if err != nil {
+			return f, fmt.Errorf("invalid actor_id")
+		}
+		f.ActorID = &actorID
+	}
+
+	if f.CreatedFrom, err = timeParam(c, "created_from"); err != nil {
+		return f, err
+	}
+	if f.CreatedTo, err = timeParam(c, "created_to"); err != nil {
+		return f, err
+	}
+	if f.CreatedFrom != nil && f.CreatedTo != nil && !f.CreatedFrom.Before(*f.CreatedTo) {
+		return f, fmt.Errorf("created_from must be before created_to")
+	}
+
+	switch sort := model.SortDirection(strings.ToLower(c.Query("sort"))); sort {
+	case "":
+		f.Sort = model.SortDesc
+	case model.SortAsc, model.SortDesc:
+		f.Sort = sort
+	default:
+		return f, fmt.Errorf("sort must be asc or desc")
+	}
+	return f, nil
+}
+
+// listParam splits a comma-separated query parameter, dropping empty items
+func listParam(c *gin.Context, name string) ([]string, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, nil
+	}
+	var values []string
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	if len(values) > maxFilterValues {
+		return nil, fmt.Errorf("at most %d values for %s", maxFilterValues, name)
+	}
+	return values, nil
+}
+
+func timeParam(c *gin.Context, name string) (*time.Time, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+	}
+	return &t, nil
+}
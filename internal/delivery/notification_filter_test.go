@@ -0,0 +1,63 @@
+package delivery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"notificationService/internal/model"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestParseNotificationFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	read := false
+	actor := uuid.New()
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	for _, tc := range []struct {
+		query   string
+		want    model.NotificationFilter
+		wantErr bool
+	}{
+		{"", model.NotificationFilter{Sort: model.SortDesc}, false},
+		{"read=false&sort=ASC", model.NotificationFilter{Read: &read, Sort: model.SortAsc}, false},
+		{"type=follow,,system&priority=high", model.NotificationFilter{
+			Types:      []model.NotificationType{model.TypeFollow, model.TypeSystem},
+			Priorities: []model.Priority{model.PriorityHigh},
+			Sort:       model.SortDesc,
+		}, false},
+		{"category=+social+,system&actor_id=" + actor.String(), model.NotificationFilter{
+			Categories: []string{"social", "system"}, ActorID: &actor, Sort: model.SortDesc,
+		}, false},
+		{"created_from=2026-01-01T00:00:00Z&created_to=2026-01-02T00:00:00Z", model.NotificationFilter{
+			CreatedFrom: &from, CreatedTo: &to, Sort: model.SortDesc,
+		}, false},
+		{"read=maybe", model.NotificationFilter{}, true},
+		{"type=follow,party", model.NotificationFilter{}, true},
+		{"priority=meh", model.NotificationFilter{}, true},
+		{"category=" + strings.Repeat("c", maxCategoryLen+1), model.NotificationFilter{}, true},
+		{"category=" + strings.Repeat("c,", maxFilterValues+1), model.NotificationFilter{}, true},
+		{"actor_id=42", model.NotificationFilter{}, true},
+		{"created_from=yesterday", model.NotificationFilter{}, true},
+		{"created_from=2026-01-02T00:00:00Z&created_to=2026-01-01T00:00:00Z", model.NotificationFilter{}, true},
+		{"created_from=2026-01-01T00:00:00Z&created_to=2026-01-01T00:00:00Z", model.NotificationFilter{}, true},
+		{"sort=random", model.NotificationFilter{}, true},
+	} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/?"+tc.query, nil)
+		got, err := parseNotificationFilter(c)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%q: got error %v, want error %v", tc.query, err, tc.wantErr)
+			continue
+		}
+		if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %+v, want %+v", tc.query, got, tc.want)
+		}
+	}
+}
@@ -1,6 +1,13 @@
 package delivery
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Sayan80bayev/go-project/pkg/logging"
+	"github.com/Sayan80bayev/go-project/pkg/middleware"
+	"io"
 	"net/http"
 	"notificationService/cmd/server/ws"
 	"notificationService/internal/model"
@@ -34,24 +41,41 @@ func (h *NotificationHandler) CreateNotification(c *gin.Context) {
 	}
 
 	var req struct {
-		Title   string `json:"title" binding:"required"`
-		Message string `json:"message" binding:"required"`
-		Type    string `json:"type"`
+		Title string `json:"title" binding:"required"`
+		Body  string `json:"body"`
+		// Message is the pre-schema name of body, still accepted from older clients
+		Message  string                 `json:"message"`
+		Type     model.NotificationType `json:"type"`
+		Category string                 `json:"category"`
+		Priority model.Priority         `json:"priority"`
+		ActorID  *uuid.UUID             `json:"actor_id"`
+		Target   *model.TargetRef       `json:"target"`
+		Metadata json.RawMessage        `json:"metadata"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.Body == "" {
+		req.Body = req.Message
+	}
 
 	n := &model.Notification{
-		UserID:  userID,
-		Message: req.Message,
+		UserID:   userID,
+		Type:     req.Type,
+		Category: req.Category,
+		Priority: req.Priority,
+		Title:    req.Title,
+		Body:     req.Body,
+		ActorID:  req.ActorID,
+		Target:   req.Target,
+		Metadata: req.Metadata,
 	}
 
 	created, err := h.svc.CreateNotification(c, n)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(createErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -71,31 +95,62 @@ func (h *NotificationHandler) GetUserNotifications(c *gin.Context) {
 		return
 	}
 
-	// Optional pagination
-	limit := 20
-	offset := 0
+	filter, err := parseNotificationFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
+	// Optional pagination: pass next_cursor from the previous page as cursor,
+	// together with the same filters and sort. limit is capped by the service.
+	limit := 0
 	if l := c.Query("limit"); l != "" {
-		if parsed, err := parsePositiveInt(l); err == nil {
-			limit = parsed
+		parsed, err := parsePositiveInt(l)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
 		}
+		limit = parsed
 	}
-	if o := c.Query("offset"); o != "" {
-		if parsed, err := parsePositiveInt(o); err == nil {
-			offset = parsed
-		}
+
+	page, err := h.svc.GetNotificationsByUser(c, userID, filter, c.Query("cursor"), limit)
+	if errors.Is(err, service.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GetUnreadCount godoc
+// Pass refresh=true to recount from the database when the badge looks wrong.
+func (h *NotificationHandler) GetUnreadCount(c *gin.Context) {
+	userID, ok := requestUserID(c)
+	if !ok {
+		return
 	}
 
-	notifications, err := h.svc.GetNotificationsByUser(c, userID, limit, offset)
+	get := h.svc.GetUnreadCounts
+	if refresh, _ := strconv.ParseBool(c.Query("refresh")); refresh {
+		get = h.svc.ReconcileUnreadCounts
+	}
+	counts, err := get(c, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, notifications)
+	c.JSON(http.StatusOK, counts)
 }
 
 // GetNotificationByID godoc
 func (h *NotificationHandler) GetNotificationByID(c *gin.Context) {
+	userID, ok := requestUserID(c)
+	if !ok {
+		return
+	}
 	idStr := c.Param("id")
 	nID, err := uuid.Parse(idStr)
 	if err != nil {
@@ -103,13 +158,13 @@ func (h *NotificationHandler) GetNotificationByID(c *gin.Context) {
 		return
 	}
 
-	notification, err := h.svc.GetNotificationByID(c, nID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	notification, err := h.svc.GetNotificationByID(c, userID, nID)
+	if errors.Is(err, service.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "notification not found"})
 		return
 	}
-	if notification == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "notification not found"})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, notification)
@@ -117,6 +172,10 @@ func (h *NotificationHandler) GetNotificationByID(c *gin.Context) {
 
 // MarkNotificationAsRead godoc
 func (h *NotificationHandler) MarkNotificationAsRead(c *gin.Context) {
+	userID, ok := requestUserID(c)
+	if !ok {
+		return
+	}
 	idStr := c.Param("id")
 	nID, err := uuid.Parse(idStr)
 	if err != nil {
@@ -124,15 +183,27 @@ func (h *NotificationHandler) MarkNotificationAsRead(c *gin.Context) {
 		return
 	}
 
-	if err := h.svc.MarkNotificationAsRead(c, nID); err != nil {
+	readAt, err := h.svc.MarkNotificationAsRead(c, userID, nID)
+	if errors.Is(err, service.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "notification not found"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"status": "marked as read", "read_at": time.Now().UTC()})
+
+	ws.SendEvent(userID, ws.EventNotificationRead, nID.String(), ws.NotificationReadPayload{IDs: []uuid.UUID{nID}, ReadAt: readAt})
+	h.pushUnreadCount(c, userID)
+	c.JSON(http.StatusOK, gin.H{"status": "marked as read", "read_at": readAt})
 }
 
 // DeleteNotification godoc
 func (h *NotificationHandler) DeleteNotification(c *gin.Context) {
+	userID, ok := requestUserID(c)
+	if !ok {
+		return
+	}
 	idStr := c.Param("id")
 	nID, err := uuid.Parse(idStr)
 	if err != nil {
@@ -140,19 +211,190 @@ func (h *NotificationHandler) DeleteNotification(c *gin.Context) {
 		return
 	}
 
-	if err := h.svc.DeleteNotification(c, nID); err != nil {
+	err = h.svc.DeleteNotification(c, userID, nID)
+	if errors.Is(err, service.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "notification not found"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+
+	ws.SendEvent(userID, ws.EventNotificationDeleted, nID.String(), ws.NotificationIDsPayload{IDs: []uuid.UUID{nID}})
+	h.pushUnreadCount(c, userID)
 	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
 }
 
+// ReadAll godoc
+// The optional body narrows it to a type and/or to notifications created before a time.
+func (h *NotificationHandler) ReadAll(c *gin.Context) {
+	userID, ok := requestUserID(c)
+	if !ok {
+		return
+	}
+
+	var filter model.ReadAllFilter
+	if err := c.ShouldBindJSON(&filter); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	count, err := h.svc.MarkAllNotificationsAsRead(c, userID, filter)
+	if errors.Is(err, service.ErrUnknownType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	readAt := time.Now().UTC()
+	if count > 0 {
+		ws.SendEvent(userID, ws.EventNotificationRead, "", ws.NotificationReadPayload{
+			All: true, Type: filter.Type, Before: filter.Before, ReadAt: readAt,
+		})
+		h.pushUnreadCount(c, userID)
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "marked as read", "updated": count, "read_at": readAt})
+}
+
+// bulkRequest is the body of the bulk endpoints
+type bulkRequest struct {
+	IDs []uuid.UUID `json:"ids" binding:"required"`
+}
+
+// BulkMarkRead godoc
+func (h *NotificationHandler) BulkMarkRead(c *gin.Context) {
+	h.bulkSetRead(c, true)
+}
+
+// BulkMarkUnread godoc
+func (h *NotificationHandler) BulkMarkUnread(c *gin.Context) {
+	h.bulkSetRead(c, false)
+}
+
+func (h *NotificationHandler) bulkSetRead(c *gin.Context, read bool) {
+	userID, ok := requestUserID(c)
+	if !ok {
+		return
+	}
+	var req bulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ids, err := h.svc.SetNotificationsRead(c, userID, req.IDs, read)
+	if err != nil {
+		c.JSON(bulkErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if ids == nil {
+		ids = []uuid.UUID{}
+	}
+
+	if len(ids) > 0 {
+		if read {
+			ws.SendEvent(userID, ws.EventNotificationRead, "", ws.NotificationReadPayload{IDs: ids, ReadAt: time.Now().UTC()})
+		} else {
+			ws.SendEvent(userID, ws.EventNotificationUnread, "", ws.NotificationIDsPayload{IDs: ids})
+		}
+		h.pushUnreadCount(c, userID)
+	}
+	c.JSON(http.StatusOK, gin.H{"updated": len(ids), "ids": ids})
+}
+
+// BulkDelete godoc
+func (h *NotificationHandler) BulkDelete(c *gin.Context) {
+	userID, ok := requestUserID(c)
+	if !ok {
+		return
+	}
+	var req bulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ids, err := h.svc.DeleteNotifications(c, userID, req.IDs)
+	if err != nil {
+		c.JSON(bulkErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if ids == nil {
+		ids = []uuid.UUID{}
+	}
+
+	if len(ids) > 0 {
+		ws.SendEvent(userID, ws.EventNotificationDeleted, "", ws.NotificationIDsPayload{IDs: ids})
+		h.pushUnreadCount(c, userID)
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": len(ids), "ids": ids})
+}
+
+// bulkErrorStatus maps bulk request validation errors to 400
+func bulkErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrNoIDs),
+		errors.Is(err, service.ErrTooManyIDs),
+		errors.Is(err, service.ErrInvalidID):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// pushUnreadCount sends the fresh badge count to the user's live sockets
+func (h *NotificationHandler) pushUnreadCount(ctx context.Context, userID uuid.UUID) {
+	count, err := h.svc.CountUnread(ctx, userID)
+	if err != nil {
+		logging.GetLogger().Warnf("unread count for user %s failed: %v", userID, err)
+		return
+	}
+	ws.SendEvent(userID, ws.EventUnreadCount, "", ws.UnreadCountPayload{Count: count})
+}
+
+// createErrorStatus maps notification validation errors to 400
+func createErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidUserID),
+		errors.Is(err, service.ErrMissingTitle),
+		errors.Is(err, service.ErrMissingMessage),
+		errors.Is(err, service.ErrUnknownType),
+		errors.Is(err, service.ErrInvalidPriority),
+		errors.Is(err, service.ErrInvalidTarget),
+		errors.Is(err, service.ErrInvalidMetadata),
+		errors.Is(err, service.ErrFieldTooLong):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// requestUserID reads the caller set by the auth middleware, answering 401 when it is missing
+func requestUserID(c *gin.Context) (uuid.UUID, bool) {
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found in context"})
+		return uuid.Nil, false
+	}
+	userID, ok := userIDVal.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid user_id type"})
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
 // local helper
 func parsePositiveInt(val string) (int, error) {
 	parsed, err := strconv.Atoi(val)
-	if err != nil || parsed < 0 {
+	if err != nil {
 		return 0, err
 	}
+	if parsed < 1 {
+		return 0, fmt.Errorf("%d is not positive", parsed)
+	}
 	return parsed, nil
 }
 
@@ -173,7 +415,7 @@ func (h *NotificationHandler) SendMessageWS(c *gin.Context) {
 		return
 	}
 
-	ws.SendNotification(userUUID, req.Message)
+	ws.SendEvent(userUUID, ws.EventMessage, "", req.Message)
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "sent",
@@ -181,3 +423,69 @@ func (h *NotificationHandler) SendMessageWS(c *gin.Context) {
 		"user":    userUUID.String(),
 	})
 }
+
+const (
+	// maxBroadcastUsers bounds explicit recipient lists, each of which may be persisted
+	maxBroadcastUsers = 1000
+	// defaultAnnouncementTitle titles persisted broadcasts sent without one
+	defaultAnnouncementTitle = "Announcement"
+)
+
+// Broadcast pushes an operator notice to every connected client or to a segment.
+// With persist the notice is also stored as a notification for each listed user,
+// so it is only accepted together with user_ids: the service cannot enumerate
+// offline users by role.
+func (h *NotificationHandler) Broadcast(c *gin.Context) {
+	var req struct {
+		Title   string            `json:"title"`
+		Message string            `json:"message" binding:"required"`
+		Data    json.RawMessage   `json:"data"`
+		UserIDs []uuid.UUID       `json:"user_ids"`
+		Roles   []middleware.Role `json:"roles"`
+		Persist bool              `json:"persist"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.UserIDs) > maxBroadcastUsers {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d user_ids per broadcast", maxBroadcastUsers)})
+		return
+	}
+	if req.Persist && (len(req.UserIDs) == 0 || len(req.Roles) > 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "persist requires user_ids and no roles"})
+		return
+	}
+
+	if req.Persist {
+		if req.Title == "" {
+			req.Title = defaultAnnouncementTitle
+		}
+		created, err := h.svc.CreateNotificationForUsers(c.Request.Context(), &model.Notification{
+			Type:     model.TypeAnnouncement,
+			Title:    req.Title,
+			Body:     req.Message,
+			Metadata: req.Data,
+		}, req.UserIDs)
+		if err != nil {
+			c.JSON(createErrorStatus(err), gin.H{"error": err.Error(), "persisted": 0})
+			return
+		}
+		// every row is stored before the first push goes out
+		for i := range created {
+			ws.SendNotification(created[i].UserID, &created[i])
+			h.pushUnreadCount(c.Request.Context(), created[i].UserID)
+		}
+		c.JSON(http.StatusAccepted, gin.H{"status": "sent", "persisted": len(created)})
+		return
+	}
+
+	segment := ws.Segment{UserIDs: req.UserIDs, Roles: req.Roles}
+	payload := ws.BroadcastPayload{Message: req.Message, Data: req.Data, SentAt: time.Now().UTC()}
+	if err := ws.Broadcast(segment, ws.EventBroadcast, payload); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "sent", "persisted": 0})
+}
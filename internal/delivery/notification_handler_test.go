@@ -0,0 +1,180 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"notificationService/cmd/server/ws"
+	"notificationService/internal/model"
+	"notificationService/internal/repository/repositorytest"
+	"notificationService/internal/service"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestRouter mounts the handlers the way the router does, with the caller
+// taken from the X-User-ID header instead of a verified token.
+func newTestRouter(repo *repositorytest.NotificationRepository) *gin.Engine {
+	h := NewNotificationHandler(service.NewNotificationService(repo, nil))
+	r := gin.New()
+	user := r.Group("/", func(c *gin.Context) {
+		c.Set("user_id", uuid.MustParse(c.GetHeader("X-User-ID")))
+	})
+	user.POST("/", h.CreateNotification)
+	user.GET("/", h.GetUserNotifications)
+	user.GET("/:id", h.GetNotificationByID)
+	user.PATCH("/:id/read", h.MarkNotificationAsRead)
+	user.DELETE("/:id", h.DeleteNotification)
+	r.POST("/admin/broadcast", h.Broadcast)
+	return r
+}
+
+func do(r *gin.Engine, method, path string, user uuid.UUID) *httptest.ResponseRecorder {
+	return doJSON(r, method, path, user, "")
+}
+
+func doJSON(r *gin.Engine, method, path string, user uuid.UUID, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-User-ID", user.String())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// openSocket registers a recorder standing in for one of owner's connections
+func openSocket(t *testing.T, owner uuid.UUID) *ws.Recorder {
+	t.Helper()
+	s := ws.NewRecorder(owner)
+	if err := ws.Register(s); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Unregister(s) })
+	return s
+}
+
+func TestForeignNotificationIsNotFound(t *testing.T) {
+	repo := repositorytest.NewNotificationRepository()
+	r := newTestRouter(repo)
+	owner, intruder := uuid.New(), uuid.New()
+	n := repo.SeedUnread(owner, "system")
+	path := "/" + n.ID.String()
+
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodGet, path},
+		{http.MethodPatch, path + "/read"},
+		{http.MethodDelete, path},
+	} {
+		if w := do(r, tc.method, tc.path, intruder); w.Code != http.StatusNotFound {
+			t.Errorf("%s %s by another user: got %d, want 404", tc.method, tc.path, w.Code)
+		}
+	}
+
+	row, ok := repo.Row(n.ID)
+	if !ok || row.IsRead || row.ReadAt != nil {
+		t.Fatalf("row changed by another user: present=%v read=%v", ok, row.IsRead)
+	}
+	if w := do(r, http.MethodGet, path, owner); w.Code != http.StatusOK {
+		t.Fatalf("owner GET: got %d, want 200", w.Code)
+	}
+}
+
+func TestSingleWritesReachLiveSockets(t *testing.T) {
+	repo := repositorytest.NewNotificationRepository()
+	r := newTestRouter(repo)
+	owner := uuid.New()
+	n := repo.SeedUnread(owner, "system")
+	sock := openSocket(t, owner)
+
+	if w := do(r, http.MethodPatch, "/"+n.ID.String()+"/read", owner); w.Code != http.StatusOK {
+		t.Fatalf("PATCH read: got %d, want 200", w.Code)
+	}
+	if err := sock.Expect(ws.EventNotificationRead, ws.EventUnreadCount); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := do(r, http.MethodDelete, "/"+n.ID.String(), owner); w.Code != http.StatusOK {
+		t.Fatalf("DELETE: got %d, want 200", w.Code)
+	}
+	if err := sock.Expect(ws.EventNotificationDeleted, ws.EventUnreadCount); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := repo.Row(n.ID); ok {
+		t.Fatal("notification still stored after DELETE")
+	}
+}
+
+func TestListRejectsInvalidLimit(t *testing.T) {
+	repo := repositorytest.NewNotificationRepository()
+	r := newTestRouter(repo)
+	user := uuid.New()
+	repo.SeedUnread(user, "system")
+
+	for _, limit := range []string{"0", "-5", "ten", "1.5"} {
+		if w := do(r, http.MethodGet, "/?limit="+limit, user); w.Code != http.StatusBadRequest {
+			t.Errorf("limit=%s: got %d, want 400", limit, w.Code)
+		}
+	}
+	if w := do(r, http.MethodGet, "/?limit=500", user); w.Code != http.StatusOK {
+		t.Errorf("limit above the page cap: got %d, want 200", w.Code)
+	}
+}
+
+func TestPersistedBroadcastStoresEveryRowBeforePushing(t *testing.T) {
+	repo := repositorytest.NewNotificationRepository()
+	r := newTestRouter(repo)
+	admin, a, b := uuid.New(), uuid.New(), uuid.New()
+	sockA, sockB := openSocket(t, a), openSocket(t, b)
+
+	body := fmt.Sprintf(`{"message":"maintenance","persist":true,"user_ids":[%q,%q,%q]}`, a, b, a)
+	w := doJSON(r, http.MethodPost, "/admin/broadcast", admin, body)
+	if w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), `"persisted":2`) {
+		t.Fatalf("got %d %s, want 202 with 2 persisted", w.Code, w.Body.String())
+	}
+	for _, sock := range []*ws.Recorder{sockA, sockB} {
+		if err := sock.Expect(ws.EventNotificationCreated, ws.EventUnreadCount); err != nil {
+			t.Fatal(err)
+		}
+		if err := sock.ExpectNothing(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// one invalid recipient rejects the whole batch
+	body = fmt.Sprintf(`{"message":"again","persist":true,"user_ids":[%q,%q]}`, a, uuid.Nil)
+	if w := doJSON(r, http.MethodPost, "/admin/broadcast", admin, body); w.Code != http.StatusBadRequest {
+		t.Fatalf("nil recipient: got %d, want 400", w.Code)
+	}
+	if err := sockA.ExpectNothing(); err != nil {
+		t.Fatal(err)
+	}
+	if page, _ := service.NewNotificationService(repo, nil).GetNotificationsByUser(context.Background(), a, model.NotificationFilter{}, "", 10); len(page.Items) != 1 {
+		t.Fatalf("recipient has %d notifications, want 1", len(page.Items))
+	}
+}
+
+func TestCreateRejectsOversizedFields(t *testing.T) {
+	r := newTestRouter(repositorytest.NewNotificationRepository())
+	user := uuid.New()
+	for _, tc := range []struct {
+		name string
+		body string
+		want int
+	}{
+		{"fits", `{"title":"t","body":"b","category":"billing"}`, http.StatusCreated},
+		{"title", fmt.Sprintf(`{"title":%q,"body":"b"}`, strings.Repeat("a", 256)), http.StatusBadRequest},
+		{"category", fmt.Sprintf(`{"title":"t","body":"b","category":%q}`, strings.Repeat("a", 51)), http.StatusBadRequest},
+		{"target type", fmt.Sprintf(`{"title":"t","body":"b","target":{"type":%q,"id":"1"}}`, strings.Repeat("a", 51)), http.StatusBadRequest},
+	} {
+		if w := doJSON(r, http.MethodPost, "/", user, tc.body); w.Code != tc.want {
+			t.Errorf("%s: got %d %s, want %d", tc.name, w.Code, w.Body.String(), tc.want)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package events
+
+import "github.com/google/uuid"
+
+const (
+	PresenceChanged = "presence.changed"
+)
+
+// PresenceChangedPayload is published when a user's first socket opens on any
+// instance (online) or their last one closes (offline).
+type PresenceChangedPayload struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Online   bool      `json:"online"`
+	LastSeen int64     `json:"last_seen_unix"`
+}
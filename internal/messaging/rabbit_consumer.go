@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/Sayan80bayev/go-project/pkg/logging"
 	"github.com/sirupsen/logrus"
+	"sync"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -21,8 +22,17 @@ type RabbitConsumer struct {
 	routingKey string
 	handlers   map[string]EventHandler
 	logger     *logrus.Logger
+
+	// running is closed when Start returns, so Close can wait for the
+	// message being handled
+	mu      sync.Mutex
+	running chan struct{}
 }
 
+// prefetchCount bounds unacknowledged deliveries; the broker requeues them if
+// the consumer closes before handling them.
+const prefetchCount = 10
+
 type EventHandler func(data []byte) error
 
 func NewRabbitConsumer(amqpURL, exchange, queue, routingKey string, logger *logrus.Logger) (*RabbitConsumer, error) {
@@ -43,6 +53,11 @@ func NewRabbitConsumer(amqpURL, exchange, queue, routingKey string, logger *logr
 		return nil, fmt.Errorf("failed to declare exchange: %w", err)
 	}
 
+	if err := ch.Qos(prefetchCount, 0, false); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to set prefetch: %w", err)
+	}
+
 	q, err := ch.QueueDeclare(queue, true, false, false, false, nil)
 	if err != nil {
 		conn.Close()
@@ -69,10 +84,16 @@ func NewRabbitConsumer(amqpURL, exchange, queue, routingKey string, logger *logr
 }
 
 func (c *RabbitConsumer) Start(ctx context.Context) {
+	running := make(chan struct{})
+	c.mu.Lock()
+	c.running = running
+	c.mu.Unlock()
+	defer close(running)
+
 	msgs, err := c.channel.Consume(
 		c.queue,
 		"",
-		true,
+		false,
 		false,
 		false,
 		false,
@@ -90,12 +111,22 @@ func (c *RabbitConsumer) Start(ctx context.Context) {
 		case <-ctx.Done():
 			c.logger.Info("[Consumer] Context canceled, shutting down...")
 			return
-		case msg := <-msgs:
+		case msg, ok := <-msgs:
+			if !ok {
+				c.logger.Warn("[Consumer] Delivery channel closed, stopping")
+				return
+			}
 			if msg.Body == nil {
+				_ = msg.Ack(false)
 				continue
 			}
 			c.logger.Infof("[Consumer] Received event=%s body=%s", msg.RoutingKey, string(msg.Body))
 			c.handleRabbitEvent(msg.RoutingKey, msg.Body)
+			// acknowledged only once handled so a shutdown mid-message
+			// leaves it to be redelivered
+			if err := msg.Ack(false); err != nil {
+				c.logger.Errorf("[Consumer] Failed to ack event=%s: %v", msg.RoutingKey, err)
+			}
 		}
 	}
 }
@@ -117,7 +148,16 @@ func (c *RabbitConsumer) RegisterHandler(eventType string, handler EventHandler)
 	c.handlers[eventType] = handler
 }
 
+// Close waits for Start to finish the message in hand, so the context passed
+// to Start must be cancelled first, then closes the channel; prefetched but
+// unhandled messages go back to the queue.
 func (c *RabbitConsumer) Close() {
+	c.mu.Lock()
+	running := c.running
+	c.mu.Unlock()
+	if running != nil {
+		<-running
+	}
 	_ = c.channel.Close()
 	_ = c.conn.Close()
 	c.logger.Info("RabbitMQ consumer closed")
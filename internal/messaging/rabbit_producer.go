@@ -0,0 +1,71 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// RabbitProducer publishes events to a topic exchange using the event type as
+// the routing key, mirroring how RabbitConsumer dispatches them. Give it an
+// exchange the consumer is not bound to, or the service reads its own events.
+type RabbitProducer struct {
+	conn     *amqp.Connection
+	channel  *amqp.Channel
+	exchange string
+	logger   *logrus.Logger
+	// amqp channels are not safe for concurrent publishing
+	mu sync.Mutex
+}
+
+func NewRabbitProducer(amqpURL, exchange string, logger *logrus.Logger) (*RabbitProducer, error) {
+	conn, err := amqp.Dial(amqpURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open channel: %w", err)
+	}
+
+	err = ch.ExchangeDeclare(exchange, "topic", true, false, false, false, nil)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to declare exchange: %w", err)
+	}
+
+	logger.Infof("RabbitMQ producer connected (exchange=%s)", exchange)
+	return &RabbitProducer{
+		conn:     conn,
+		channel:  ch,
+		exchange: exchange,
+		logger:   logger,
+	}, nil
+}
+
+func (p *RabbitProducer) Produce(ctx context.Context, eventType string, data interface{}) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %w", eventType, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.channel.PublishWithContext(ctx, p.exchange, eventType, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Body:         body,
+	})
+}
+
+func (p *RabbitProducer) Close() {
+	_ = p.channel.Close()
+	_ = p.conn.Close()
+	p.logger.Info("RabbitMQ producer closed")
+}
@@ -0,0 +1,7 @@
+package model
+
+import "errors"
+
+// ErrNotFound is returned for notifications that do not exist or belong to
+// another user; the two are deliberately indistinguishable.
+var ErrNotFound = errors.New("notification not found")
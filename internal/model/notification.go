@@ -1,16 +1,35 @@
 package model
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Notification struct {
-	ID        uuid.UUID  `json:"id"`
-	UserID    uuid.UUID  `json:"user_id"`
-	Message   string     `json:"message"`
-	IsRead    bool       `json:"is_read"`
-	CreatedAt time.Time  `json:"created_at"`
-	ReadAt    *time.Time `json:"read_at,omitempty"`
+	ID       uuid.UUID        `json:"id"`
+	UserID   uuid.UUID        `json:"user_id"`
+	Type     NotificationType `json:"type"`
+	Category string           `json:"category"`
+	Priority Priority         `json:"priority"`
+	Title    string           `json:"title"`
+	Body     string           `json:"body"`
+	// ActorID is the user whose action caused the notification, if any
+	ActorID *uuid.UUID `json:"actor_id,omitempty"`
+	// Target points at the resource the notification is about
+	Target *TargetRef `json:"target,omitempty"`
+	// Metadata is a free-form JSON object rendered by clients per type
+	Metadata  json.RawMessage `json:"metadata"`
+	IsRead    bool            `json:"is_read"`
+	CreatedAt time.Time       `json:"created_at"`
+	ReadAt    *time.Time      `json:"read_at,omitempty"`
+	// DeliveredAt is set once a client acknowledges a push
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+// TargetRef references a resource owned by another service, e.g. {"type": "post", "id": "..."}
+type TargetRef struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
 }
@@ -0,0 +1,55 @@
+package model
+
+// NotificationType identifies what happened; clients pick a template by it.
+// Only registered types are accepted, so producers cannot invent new ones
+// without the registry (and clients) knowing about them.
+type NotificationType string
+
+const (
+	TypeSystem       NotificationType = "system"
+	TypeFollow       NotificationType = "follow"
+	TypeAnnouncement NotificationType = "announcement"
+)
+
+// Priority orders notifications for presentation; it does not affect delivery.
+type Priority string
+
+const (
+	PriorityLow    Priority = "low"
+	PriorityNormal Priority = "normal"
+	PriorityHigh   Priority = "high"
+	PriorityUrgent Priority = "urgent"
+)
+
+// Valid reports whether p is one of the known priorities.
+func (p Priority) Valid() bool {
+	switch p {
+	case PriorityLow, PriorityNormal, PriorityHigh, PriorityUrgent:
+		return true
+	}
+	return false
+}
+
+// TypeInfo holds the defaults applied to notifications of a type
+type TypeInfo struct {
+	Category string
+	Priority Priority
+}
+
+var typeRegistry = map[NotificationType]TypeInfo{
+	TypeSystem:       {Category: "system", Priority: PriorityNormal},
+	TypeFollow:       {Category: "social", Priority: PriorityNormal},
+	TypeAnnouncement: {Category: "system", Priority: PriorityHigh},
+}
+
+// LookupType returns the registered defaults of t.
+func LookupType(t NotificationType) (TypeInfo, bool) {
+	info, ok := typeRegistry[t]
+	return info, ok
+}
+
+// Valid reports whether t is registered.
+func (t NotificationType) Valid() bool {
+	_, ok := typeRegistry[t]
+	return ok
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Cursor is the (created_at, id) key of the last notification on a page
+type Cursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        uuid.UUID `json:"i"`
+	// Asc records the sort the cursor was issued for; it is only valid for that sort
+	Asc bool `json:"a,omitempty"`
+}
+
+// SortDirection orders the feed by (created_at, id)
+type SortDirection string
+
+const (
+	SortDesc SortDirection = "desc"
+	SortAsc  SortDirection = "asc"
+)
+
+// NotificationFilter narrows a user's feed; zero fields match everything and
+// the values of a list field are alternatives
+type NotificationFilter struct {
+	Read        *bool
+	Types       []NotificationType
+	Categories  []string
+	Priorities  []Priority
+	ActorID     *uuid.UUID
+	CreatedFrom *time.Time // inclusive
+	CreatedTo   *time.Time // exclusive
+	Sort        SortDirection
+}
+
+// NotificationPage is one page of a user's feed
+type NotificationPage struct {
+	Items []Notification `json:"items"`
+	// NextCursor is opaque to clients; it is empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// UnreadCounts is a user's unread badge: the total and its split by category
+type UnreadCounts struct {
+	Total      int64            `json:"total"`
+	ByCategory map[string]int64 `json:"by_category"`
+}
+
+// ReadAllFilter narrows a read-all; zero fields match everything
+type ReadAllFilter struct {
+	Type   NotificationType `json:"type,omitempty"`
+	Before *time.Time       `json:"before,omitempty"`
+}
@@ -4,18 +4,48 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"notificationService/internal/model"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type NotificationRepository interface {
 	Create(ctx context.Context, n *model.Notification) error
-	FindByID(ctx context.Context, id uuid.UUID) (*model.Notification, error)
-	FindByUserID(ctx context.Context, userID uuid.UUID, limit, offset int) ([]model.Notification, error)
-	MarkAsRead(ctx context.Context, id uuid.UUID, readAt time.Time) error
-	Delete(ctx context.Context, id uuid.UUID) error
+	CreateForUsers(ctx context.Context, n *model.Notification, userIDs []uuid.UUID) ([]uuid.UUID, error)
+	FindByID(ctx context.Context, userID, id uuid.UUID) (*model.Notification, error)
+	FindPage(ctx context.Context, userID uuid.UUID, filter model.NotificationFilter, after *model.Cursor, limit int) ([]model.Notification, error)
+	FindByUserIDAfter(ctx context.Context, userID uuid.UUID, after time.Time, afterID uuid.UUID, limit int) ([]model.Notification, error)
+	FindUndelivered(ctx context.Context, userID uuid.UUID, since time.Time, maxAttempts, limit int) ([]model.Notification, error)
+	MarkAsRead(ctx context.Context, userID, id uuid.UUID, readAt time.Time) (*StateChange, error)
+	MarkAllAsRead(ctx context.Context, userID uuid.UUID, filter model.ReadAllFilter, readAt time.Time) (*BulkChange, error)
+	SetRead(ctx context.Context, userID uuid.UUID, ids []uuid.UUID, read bool, at time.Time) (*BulkChange, error)
+	DeleteMany(ctx context.Context, userID uuid.UUID, ids []uuid.UUID) (*BulkChange, error)
+	MarkDelivered(ctx context.Context, userID, id uuid.UUID, deliveredAt time.Time) (bool, error)
+	IncrementDeliveryAttempts(ctx context.Context, userID uuid.UUID, attempts map[uuid.UUID]int) error
+	CountUnread(ctx context.Context, userID uuid.UUID) (int64, error)
+	CountUnreadByCategory(ctx context.Context, userID uuid.UUID) (model.UnreadCounts, error)
+	Delete(ctx context.Context, userID, id uuid.UUID) (*StateChange, error)
+}
+
+// StateChange describes the notification a write touched, so unread counters
+// can follow it; a nil StateChange means no notification matched
+type StateChange struct {
+	Category  string
+	WasUnread bool
+	// ReadAt is the stored read time; only MarkAsRead sets it
+	ReadAt time.Time
+}
+
+// BulkChange lists the notifications a set-based write touched and how it
+// moved the unread count of each category
+type BulkChange struct {
+	IDs         []uuid.UUID
+	UnreadDelta map[string]int64
 }
 
 type notificationRepo struct {
@@ -26,23 +56,81 @@ func NewNotificationRepository(db *sql.DB) NotificationRepository {
 	return &notificationRepo{db: db}
 }
 
+// notificationColumns is the select list matching scanNotification
+const notificationColumns = `id, user_id, type, category, priority, title, body, actor_id, target_type, target_id, metadata, is_read, created_at, read_at, delivered_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanNotification(row rowScanner) (model.Notification, error) {
+	var (
+		n          model.Notification
+		actorID    uuid.NullUUID
+		targetType sql.NullString
+		targetID   sql.NullString
+		metadata   []byte
+	)
+	err := row.Scan(
+		&n.ID,
+		&n.UserID,
+		&n.Type,
+		&n.Category,
+		&n.Priority,
+		&n.Title,
+		&n.Body,
+		&actorID,
+		&targetType,
+		&targetID,
+		&metadata,
+		&n.IsRead,
+		&n.CreatedAt,
+		&n.ReadAt,
+		&n.DeliveredAt,
+	)
+	if err != nil {
+		return n, err
+	}
+	if actorID.Valid {
+		n.ActorID = &actorID.UUID
+	}
+	if targetType.Valid {
+		n.Target = &model.TargetRef{Type: targetType.String, ID: targetID.String}
+	}
+	n.Metadata = metadata
+	return n, nil
+}
+
 // Create inserts a new notification securely
 func (r *notificationRepo) Create(ctx context.Context, n *model.Notification) error {
 	if n.ID == uuid.Nil {
 		n.ID = uuid.New()
 	}
+	var targetType, targetID sql.NullString
+	if n.Target != nil {
+		targetType = sql.NullString{String: n.Target.Type, Valid: true}
+		targetID = sql.NullString{String: n.Target.ID, Valid: true}
+	}
 	query := `
-		INSERT INTO notifications 
-		    (id, user_id, message, is_read, created_at, read_at)
-		VALUES 
-		    ($1, $2, $3, $4, $5, $6)
+		INSERT INTO notifications
+		    (id, user_id, type, category, priority, title, body, actor_id, target_type, target_id, metadata, is_read, created_at, read_at)
+		VALUES
+		    ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 	`
 	_, err := r.db.ExecContext(
 		ctx,
 		query,
 		n.ID,
 		n.UserID,
-		n.Message,
+		n.Type,
+		n.Category,
+		n.Priority,
+		n.Title,
+		n.Body,
+		n.ActorID,
+		targetType,
+		targetID,
+		string(n.Metadata),
 		n.IsRead,
 		n.CreatedAt,
 		n.ReadAt,
@@ -50,24 +138,60 @@ func (r *notificationRepo) Create(ctx context.Context, n *model.Notification) er
 	return err
 }
 
-// FindByID retrieves a notification by its ID
-func (r *notificationRepo) FindByID(ctx context.Context, id uuid.UUID) (*model.Notification, error) {
+// CreateForUsers stores a copy of n for each user in one statement, so either
+// every copy is stored or none is; it returns the copies' IDs in user order
+func (r *notificationRepo) CreateForUsers(ctx context.Context, n *model.Notification, userIDs []uuid.UUID) ([]uuid.UUID, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	ids := make([]uuid.UUID, len(userIDs))
+	for i := range ids {
+		ids[i] = uuid.New()
+	}
+	var targetType, targetID sql.NullString
+	if n.Target != nil {
+		targetType = sql.NullString{String: n.Target.Type, Valid: true}
+		targetID = sql.NullString{String: n.Target.ID, Valid: true}
+	}
 	query := `
-		SELECT id, user_id, message, is_read, created_at, read_at
-		FROM notifications
-		WHERE id = $1
+		INSERT INTO notifications
+		    (id, user_id, type, category, priority, title, body, actor_id, target_type, target_id, metadata, is_read, created_at, read_at)
+		SELECT r.id, r.user_id, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14
+		FROM unnest($1::uuid[], $2::uuid[]) AS r(id, user_id)
 	`
-	row := r.db.QueryRowContext(ctx, query, id)
+	_, err := r.db.ExecContext(
+		ctx,
+		query,
+		uuidArray(ids),
+		uuidArray(userIDs),
+		n.Type,
+		n.Category,
+		n.Priority,
+		n.Title,
+		n.Body,
+		n.ActorID,
+		targetType,
+		targetID,
+		string(n.Metadata),
+		n.IsRead,
+		n.CreatedAt,
+		n.ReadAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
 
-	var n model.Notification
-	if err := row.Scan(
-		&n.ID,
-		&n.UserID,
-		&n.Message,
-		&n.IsRead,
-		&n.CreatedAt,
-		&n.ReadAt,
-	); err != nil {
+// FindByID retrieves a user's notification by its ID; nil when it is missing or foreign
+func (r *notificationRepo) FindByID(ctx context.Context, userID, id uuid.UUID) (*model.Notification, error) {
+	query := `
+		SELECT ` + notificationColumns + `
+		FROM notifications
+		WHERE id = $1 AND user_id = $2
+	`
+	n, err := scanNotification(r.db.QueryRowContext(ctx, query, id, userID))
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
@@ -76,16 +200,107 @@ func (r *notificationRepo) FindByID(ctx context.Context, id uuid.UUID) (*model.N
 	return &n, nil
 }
 
-// FindByUserID retrieves notifications for a user with pagination
-func (r *notificationRepo) FindByUserID(ctx context.Context, userID uuid.UUID, limit, offset int) ([]model.Notification, error) {
+// FindPage retrieves up to limit notifications of a user matching filter, in the
+// filter's sort order and continuing past the (created_at, id) key when one is given
+func (r *notificationRepo) FindPage(ctx context.Context, userID uuid.UUID, filter model.NotificationFilter, after *model.Cursor, limit int) ([]model.Notification, error) {
+	w := &where{}
+	w.add("user_id = $%d", userID)
+	if filter.Read != nil {
+		w.add("is_read = $%d", *filter.Read)
+	}
+	if len(filter.Types) > 0 {
+		types := make([]string, len(filter.Types))
+		for i, t := range filter.Types {
+			types[i] = string(t)
+		}
+		w.add("type = ANY($%d)", pq.Array(types))
+	}
+	if len(filter.Categories) > 0 {
+		w.add("category = ANY($%d)", pq.Array(filter.Categories))
+	}
+	if len(filter.Priorities) > 0 {
+		priorities := make([]string, len(filter.Priorities))
+		for i, p := range filter.Priorities {
+			priorities[i] = string(p)
+		}
+		w.add("priority = ANY($%d)", pq.Array(priorities))
+	}
+	if filter.ActorID != nil {
+		w.add("actor_id = $%d", *filter.ActorID)
+	}
+	if filter.CreatedFrom != nil {
+		w.add("created_at >= $%d", filter.CreatedFrom.UTC())
+	}
+	if filter.CreatedTo != nil {
+		w.add("created_at < $%d", filter.CreatedTo.UTC())
+	}
+
+	order, cmp := "DESC", "<"
+	if filter.Sort == model.SortAsc {
+		order, cmp = "ASC", ">"
+	}
+	if after != nil {
+		w.add("(created_at, id) "+cmp+" ($%d, $%d)", after.CreatedAt, after.ID)
+	}
+
+	args := append(w.args, limit)
+	query := `
+		SELECT ` + notificationColumns + `
+		FROM notifications
+		WHERE ` + w.String() + `
+		ORDER BY created_at ` + order + `, id ` + order + `
+		LIMIT $` + strconv.Itoa(len(args))
+	return r.query(ctx, query, args...)
+}
+
+// where assembles a WHERE clause from fixed SQL fragments; every value travels
+// as a bind parameter, fragments only get the placeholder numbers
+type where struct {
+	clauses []string
+	args    []any
+}
+
+// add appends a fragment with one %d verb per value, numbered after the previous ones
+func (w *where) add(fragment string, values ...any) {
+	placeholders := make([]any, len(values))
+	for i := range values {
+		placeholders[i] = len(w.args) + i + 1
+	}
+	w.args = append(w.args, values...)
+	w.clauses = append(w.clauses, fmt.Sprintf(fragment, placeholders...))
+}
+
+func (w *where) String() string {
+	return strings.Join(w.clauses, " AND ")
+}
+
+// FindByUserIDAfter retrieves notifications ordered after the (created_at, id) key, oldest first
+func (r *notificationRepo) FindByUserIDAfter(ctx context.Context, userID uuid.UUID, after time.Time, afterID uuid.UUID, limit int) ([]model.Notification, error) {
+	query := `
+		SELECT ` + notificationColumns + `
+		FROM notifications
+		WHERE user_id = $1 AND (created_at, id) > ($2, $3)
+		ORDER BY created_at ASC, id ASC
+		LIMIT $4
+	`
+	return r.query(ctx, query, userID, after, afterID, limit)
+}
+
+// FindUndelivered retrieves notifications created since the given time that were never
+// acknowledged and still have delivery attempts left, oldest first
+func (r *notificationRepo) FindUndelivered(ctx context.Context, userID uuid.UUID, since time.Time, maxAttempts, limit int) ([]model.Notification, error) {
 	query := `
-		SELECT id, user_id, message, is_read, created_at, read_at
+		SELECT ` + notificationColumns + `
 		FROM notifications
-		WHERE user_id = $1
-		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3
+		WHERE user_id = $1 AND delivered_at IS NULL AND created_at >= $2 AND delivery_attempts < $3
+		ORDER BY created_at ASC, id ASC
+		LIMIT $4
 	`
-	rows, err := r.db.QueryContext(ctx, query, userID, limit, offset)
+	return r.query(ctx, query, userID, since, maxAttempts, limit)
+}
+
+func (r *notificationRepo) query(ctx context.Context, query string, args ...any) ([]model.Notification, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -93,15 +308,8 @@ func (r *notificationRepo) FindByUserID(ctx context.Context, userID uuid.UUID, l
 
 	var notifications []model.Notification
 	for rows.Next() {
-		var n model.Notification
-		if err := rows.Scan(
-			&n.ID,
-			&n.UserID,
-			&n.Message,
-			&n.IsRead,
-			&n.CreatedAt,
-			&n.ReadAt,
-		); err != nil {
+		n, err := scanNotification(rows)
+		if err != nil {
 			return nil, err
 		}
 		notifications = append(notifications, n)
@@ -109,20 +317,195 @@ func (r *notificationRepo) FindByUserID(ctx context.Context, userID uuid.UUID, l
 	return notifications, rows.Err()
 }
 
-// MarkAsRead sets a notification as read
-func (r *notificationRepo) MarkAsRead(ctx context.Context, id uuid.UUID, readAt time.Time) error {
+// MarkAsRead sets a user's notification as read; it returns nil when the
+// notification is missing or foreign. read_at keeps the first read time,
+// which the change reports.
+func (r *notificationRepo) MarkAsRead(ctx context.Context, userID, id uuid.UUID, readAt time.Time) (*StateChange, error) {
+	query := `
+		UPDATE notifications n
+		SET is_read = TRUE, read_at = COALESCE(n.read_at, $1)
+		FROM (
+			SELECT id, is_read FROM notifications
+			WHERE id = $2 AND user_id = $3
+			FOR UPDATE
+		) prev
+		WHERE n.id = prev.id
+		RETURNING n.category, NOT prev.is_read, n.read_at
+	`
+	var change StateChange
+	err := r.db.QueryRowContext(ctx, query, readAt, id, userID).Scan(&change.Category, &change.WasUnread, &change.ReadAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+func (r *notificationRepo) stateChange(row *sql.Row) (*StateChange, error) {
+	var change StateChange
+	if err := row.Scan(&change.Category, &change.WasUnread); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &change, nil
+}
+
+// MarkAllAsRead marks every unread notification of a user matching filter as read
+func (r *notificationRepo) MarkAllAsRead(ctx context.Context, userID uuid.UUID, filter model.ReadAllFilter, readAt time.Time) (*BulkChange, error) {
+	// $1 is taken by the SET clause
+	w := &where{args: []any{readAt}}
+	w.add("user_id = $%d", userID)
+	w.add("is_read = FALSE")
+	if filter.Type != "" {
+		w.add("type = $%d", filter.Type)
+	}
+	if filter.Before != nil {
+		w.add("created_at < $%d", filter.Before.UTC())
+	}
 	query := `
 		UPDATE notifications
 		SET is_read = TRUE, read_at = $1
-		WHERE id = $2
+		WHERE ` + w.String() + `
+		RETURNING id, category, -1`
+	return r.bulkChange(ctx, query, w.args...)
+}
+
+// SetRead marks the listed notifications of a user read or unread in one
+// statement; IDs that are foreign or already in that state are left out of the result
+func (r *notificationRepo) SetRead(ctx context.Context, userID uuid.UUID, ids []uuid.UUID, read bool, at time.Time) (*BulkChange, error) {
+	query := `
+		UPDATE notifications
+		SET is_read = $1, read_at = CASE WHEN $1 THEN COALESCE(read_at, $2) END
+		WHERE user_id = $3 AND id = ANY($4::uuid[]) AND is_read <> $1
+		RETURNING id, category, CASE WHEN $1 THEN -1 ELSE 1 END
 	`
-	_, err := r.db.ExecContext(ctx, query, readAt, id)
-	return err
+	return r.bulkChange(ctx, query, read, at, userID, uuidArray(ids))
+}
+
+// DeleteMany removes the listed notifications of a user in one statement; foreign IDs are ignored
+func (r *notificationRepo) DeleteMany(ctx context.Context, userID uuid.UUID, ids []uuid.UUID) (*BulkChange, error) {
+	query := `
+		DELETE FROM notifications
+		WHERE user_id = $1 AND id = ANY($2::uuid[])
+		RETURNING id, category, CASE WHEN is_read THEN 0 ELSE -1 END
+	`
+	return r.bulkChange(ctx, query, userID, uuidArray(ids))
+}
+
+// bulkChange collects (id, category, unread delta) rows returned by a set-based write
+func (r *notificationRepo) bulkChange(ctx context.Context, query string, args ...any) (*BulkChange, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	change := &BulkChange{UnreadDelta: make(map[string]int64)}
+	for rows.Next() {
+		var (
+			id       uuid.UUID
+			category string
+			delta    int64
+		)
+		if err := rows.Scan(&id, &category, &delta); err != nil {
+			return nil, err
+		}
+		change.IDs = append(change.IDs, id)
+		if delta != 0 {
+			change.UnreadDelta[category] += delta
+		}
+	}
+	return change, rows.Err()
+}
+
+func uuidArray(ids []uuid.UUID) interface{} {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = id.String()
+	}
+	return pq.Array(strs)
 }
 
-// Delete removes a notification
-func (r *notificationRepo) Delete(ctx context.Context, id uuid.UUID) error {
-	query := `DELETE FROM notifications WHERE id = $1`
-	_, err := r.db.ExecContext(ctx, query, id)
+// MarkDelivered records the first acknowledged delivery; it reports false when the
+// notification was already delivered or does not belong to the user
+func (r *notificationRepo) MarkDelivered(ctx context.Context, userID, id uuid.UUID, deliveredAt time.Time) (bool, error) {
+	query := `
+		UPDATE notifications
+		SET delivered_at = $1
+		WHERE id = $2 AND user_id = $3 AND delivered_at IS NULL
+	`
+	res, err := r.db.ExecContext(ctx, query, deliveredAt, id, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+// IncrementDeliveryAttempts adds a batch of push counts to a user's notifications in one statement; foreign IDs are ignored
+func (r *notificationRepo) IncrementDeliveryAttempts(ctx context.Context, userID uuid.UUID, attempts map[uuid.UUID]int) error {
+	if len(attempts) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, 0, len(attempts))
+	counts := make([]int64, 0, len(attempts))
+	for id, n := range attempts {
+		ids = append(ids, id)
+		counts = append(counts, int64(n))
+	}
+	query := `
+		UPDATE notifications n
+		SET delivery_attempts = n.delivery_attempts + a.n
+		FROM unnest($2::uuid[], $3::int[]) AS a(id, n)
+		WHERE n.id = a.id AND n.user_id = $1
+	`
+	_, err := r.db.ExecContext(ctx, query, userID, uuidArray(ids), pq.Array(counts))
 	return err
 }
+
+// CountUnread counts a user's unread notifications
+func (r *notificationRepo) CountUnread(ctx context.Context, userID uuid.UUID) (int64, error) {
+	query := `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND is_read = FALSE`
+	var count int64
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// CountUnreadByCategory counts a user's unread notifications per category
+func (r *notificationRepo) CountUnreadByCategory(ctx context.Context, userID uuid.UUID) (model.UnreadCounts, error) {
+	counts := model.UnreadCounts{ByCategory: make(map[string]int64)}
+	query := `
+		SELECT category, COUNT(*)
+		FROM notifications
+		WHERE user_id = $1 AND is_read = FALSE
+		GROUP BY category
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return counts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			category string
+			n        int64
+		)
+		if err := rows.Scan(&category, &n); err != nil {
+			return counts, err
+		}
+		counts.ByCategory[category] = n
+		counts.Total += n
+	}
+	return counts, rows.Err()
+}
+
+// Delete removes a user's notification; it returns nil when the notification is missing or foreign
+func (r *notificationRepo) Delete(ctx context.Context, userID, id uuid.UUID) (*StateChange, error) {
+	query := `DELETE FROM notifications WHERE id = $1 AND user_id = $2 RETURNING category, NOT is_read`
+	return r.stateChange(r.db.QueryRowContext(ctx, query, id, userID))
+}
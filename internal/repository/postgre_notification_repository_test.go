@@ -0,0 +1,255 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"notificationService/internal/model"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+// Every statement that reads or writes a single notification must be scoped
+// to its owner; these tests pin the ownership predicate and its arguments.
+
+func newMockRepo(t *testing.T) (NotificationRepository, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		_ = db.Close()
+	})
+	return NewNotificationRepository(db), mock
+}
+
+func TestFindByIDIsScopedToOwner(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	user, id := uuid.New(), uuid.New()
+	mock.ExpectQuery(`FROM notifications\s+WHERE id = \$1 AND user_id = \$2`).
+		WithArgs(id.String(), user.String()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	n, err := repo.FindByID(context.Background(), user, id)
+	if err != nil || n != nil {
+		t.Fatalf("got %v, %v, want nil for a foreign or missing row", n, err)
+	}
+}
+
+func TestMarkAsReadIsScopedToOwner(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	user, id := uuid.New(), uuid.New()
+	readAt := time.Now()
+	firstRead := readAt.Add(-time.Hour)
+	mock.ExpectQuery(`UPDATE notifications n .* WHERE id = \$2 AND user_id = \$3\s+FOR UPDATE`).
+		WithArgs(readAt, id.String(), user.String()).
+		WillReturnRows(sqlmock.NewRows([]string{"category", "was_unread", "read_at"}))
+	mock.ExpectQuery(`WHERE id = \$2 AND user_id = \$3 .* RETURNING n.category, NOT prev.is_read, n.read_at`).
+		WithArgs(readAt, id.String(), user.String()).
+		WillReturnRows(sqlmock.NewRows([]string{"category", "was_unread", "read_at"}).AddRow("social", true, firstRead))
+
+	change, err := repo.MarkAsRead(context.Background(), user, id, readAt)
+	if err != nil || change != nil {
+		t.Fatalf("foreign row: got %v, %v, want no change", change, err)
+	}
+	change, err = repo.MarkAsRead(context.Background(), user, id, readAt)
+	if err != nil || change == nil || change.Category != "social" || !change.WasUnread || !change.ReadAt.Equal(firstRead) {
+		t.Fatalf("own row: got %+v, %v, want the stored read_at", change, err)
+	}
+}
+
+func TestDeleteIsScopedToOwner(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	user, id := uuid.New(), uuid.New()
+	mock.ExpectQuery(`DELETE FROM notifications WHERE id = \$1 AND user_id = \$2`).
+		WithArgs(id.String(), user.String()).
+		WillReturnRows(sqlmock.NewRows([]string{"category", "was_unread"}))
+
+	change, err := repo.Delete(context.Background(), user, id)
+	if err != nil || change != nil {
+		t.Fatalf("got %v, %v, want no change for a foreign or missing row", change, err)
+	}
+}
+
+func TestDeleteManyIsScopedToOwner(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	user := uuid.New()
+	mock.ExpectQuery(`DELETE FROM notifications\s+WHERE user_id = \$1 AND id = ANY\(\$2::uuid\[\]\)`).
+		WithArgs(user.String(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "category", "delta"}))
+
+	change, err := repo.DeleteMany(context.Background(), user, []uuid.UUID{uuid.New()})
+	if err != nil || len(change.IDs) != 0 {
+		t.Fatalf("got %+v, %v, want nothing deleted", change, err)
+	}
+}
+
+func TestIncrementDeliveryAttemptsIsScopedToOwner(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	user := uuid.New()
+	mock.ExpectExec(`UPDATE notifications n .* WHERE n.id = a.id AND n.user_id = \$1`).
+		WithArgs(user.String(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.IncrementDeliveryAttempts(context.Background(), user, map[uuid.UUID]int{uuid.New(): 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an empty batch never reaches the database
+	if err := repo.IncrementDeliveryAttempts(context.Background(), user, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateForUsersIsOneStatement(t *testing.T) {
+	repo, mock := newMockRepo(t)
+	users := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	mock.ExpectExec(`INSERT INTO notifications .* SELECT r.id, r.user_id, .* FROM unnest\(\$1::uuid\[\], \$2::uuid\[\]\)`).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	ids, err := repo.CreateForUsers(context.Background(), &model.Notification{Title: "t", Body: "b"}, users)
+	if err != nil || len(ids) != len(users) {
+		t.Fatalf("got %v, %v, want %d ids", ids, err, len(users))
+	}
+}
+
+func TestBulkWritesReportUnreadDeltas(t *testing.T) {
+	user := uuid.New()
+	a, b := uuid.New(), uuid.New()
+	at := time.Now()
+	rows := func(deltas ...int) *sqlmock.Rows {
+		r := sqlmock.NewRows([]string{"id", "category", "delta"})
+		for i, d := range deltas {
+			r.AddRow([]uuid.UUID{a, b}[i].String(), "social", d)
+		}
+		return r
+	}
+
+	for _, tc := range []struct {
+		name  string
+		query string
+		args  []driver.Value
+		rows  *sqlmock.Rows
+		run   func(NotificationRepository) (*BulkChange, error)
+		delta int64
+	}{
+		{
+			"mark read",
+			`UPDATE notifications SET is_read = \$1, read_at = CASE WHEN \$1 THEN COALESCE\(read_at, \$2\) END WHERE user_id = \$3 AND id = ANY\(\$4::uuid\[\]\) AND is_read <> \$1`,
+			[]driver.Value{true, at, user.String(), sqlmock.AnyArg()},
+			rows(-1, -1),
+			func(r NotificationRepository) (*BulkChange, error) {
+				return r.SetRead(context.Background(), user, []uuid.UUID{a, b}, true, at)
+			},
+			-2,
+		},
+		{
+			"mark unread",
+			`UPDATE notifications SET is_read = \$1, .* RETURNING id, category, CASE WHEN \$1 THEN -1 ELSE 1 END`,
+			[]driver.Value{false, at, user.String(), sqlmock.AnyArg()},
+			rows(1),
+			func(r NotificationRepository) (*BulkChange, error) {
+				return r.SetRead(context.Background(), user, []uuid.UUID{a}, false, at)
+			},
+			1,
+		},
+		{
+			"delete many",
+			`DELETE FROM notifications WHERE user_id = \$1 AND id = ANY\(\$2::uuid\[\]\) RETURNING id, category, CASE WHEN is_read THEN 0 ELSE -1 END`,
+			[]driver.Value{user.String(), sqlmock.AnyArg()},
+			rows(0, -1),
+			func(r NotificationRepository) (*BulkChange, error) {
+				return r.DeleteMany(context.Background(), user, []uuid.UUID{a, b})
+			},
+			-1,
+		},
+		{
+			"mark all read by type and age",
+			`UPDATE notifications SET is_read = TRUE, read_at = \$1 WHERE user_id = \$2 AND is_read = FALSE AND type = \$3 AND created_at < \$4 RETURNING id, category, -1`,
+			[]driver.Value{at, user.String(), model.TypeSystem, at.UTC()},
+			rows(-1, -1),
+			func(r NotificationRepository) (*BulkChange, error) {
+				return r.MarkAllAsRead(context.Background(), user, model.ReadAllFilter{Type: model.TypeSystem, Before: &at}, at)
+			},
+			-2,
+		},
+	} {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery(tc.query).WithArgs(tc.args...).WillReturnRows(tc.rows)
+		change, err := tc.run(repo)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if change.UnreadDelta["social"] != tc.delta {
+			t.Errorf("%s: unread delta %d, want %d", tc.name, change.UnreadDelta["social"], tc.delta)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+	}
+}
+
+func TestFindPageBuildsOneParameterPerValue(t *testing.T) {
+	user, actor, last := uuid.New(), uuid.New(), uuid.New()
+	read := true
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	after := &model.Cursor{CreatedAt: from.Add(time.Hour), ID: last}
+
+	for _, tc := range []struct {
+		name   string
+		filter model.NotificationFilter
+		after  *model.Cursor
+		query  string
+		args   []driver.Value
+	}{
+		{
+			"owner only, newest first",
+			model.NotificationFilter{Sort: model.SortDesc},
+			nil,
+			`WHERE user_id = \$1 ORDER BY created_at DESC, id DESC LIMIT \$2$`,
+			[]driver.Value{user.String(), 21},
+		},
+		{
+			"cursor continues below the last row",
+			model.NotificationFilter{Sort: model.SortDesc},
+			after,
+			`WHERE user_id = \$1 AND \(created_at, id\) < \(\$2, \$3\) ORDER BY created_at DESC, id DESC LIMIT \$4$`,
+			[]driver.Value{user.String(), after.CreatedAt, last.String(), 21},
+		},
+		{
+			"every filter, oldest first",
+			model.NotificationFilter{
+				Read:        &read,
+				Types:       []model.NotificationType{model.TypeFollow},
+				Categories:  []string{"social"},
+				Priorities:  []model.Priority{model.PriorityHigh, model.PriorityUrgent},
+				ActorID:     &actor,
+				CreatedFrom: &from,
+				CreatedTo:   &to,
+				Sort:        model.SortAsc,
+			},
+			after,
+			`WHERE user_id = \$1 AND is_read = \$2 AND type = ANY\(\$3\) AND category = ANY\(\$4\) AND priority = ANY\(\$5\) ` +
+				`AND actor_id = \$6 AND created_at >= \$7 AND created_at < \$8 AND \(created_at, id\) > \(\$9, \$10\) ` +
+				`ORDER BY created_at ASC, id ASC LIMIT \$11$`,
+			[]driver.Value{user.String(), true, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), actor.String(), from, to, after.CreatedAt, last.String(), 21},
+		},
+	} {
+		repo, mock := newMockRepo(t)
+		mock.ExpectQuery(tc.query).WithArgs(tc.args...).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		if _, err := repo.FindPage(context.Background(), user, tc.filter, tc.after, 21); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"notificationService/internal/model"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	unreadKeyPrefix      = "notif:unread:"
+	unreadGenKeyPrefix   = "notif:unread-gen:"
+	unreadTotalField     = "total"
+	unreadCategoryPrefix = "cat:"
+
+	// DefaultUnreadCacheTTL bounds how long a drifted counter can survive
+	// before it is rebuilt from Postgres
+	DefaultUnreadCacheTTL = 10 * time.Minute
+)
+
+// UnreadCounter caches per-user unread counts; Postgres stays the source of truth.
+//
+// Every Add and Invalidate bumps a per-user generation. A rebuild reads the
+// generation before counting in Postgres and passes it to Set, which drops the
+// snapshot if a write landed in between; otherwise the slower recount would
+// overwrite the newer delta.
+type UnreadCounter interface {
+	// Get returns the cached counts, or nil when the cache is cold
+	Get(ctx context.Context, userID uuid.UUID) (*model.UnreadCounts, error)
+	// Generation returns the user's current write generation
+	Generation(ctx context.Context, userID uuid.UUID) (int64, error)
+	// Set replaces the cached counts with a snapshot counted at gen; it
+	// reports false and leaves the cache alone when a write happened since
+	Set(ctx context.Context, userID uuid.UUID, gen int64, counts model.UnreadCounts) (bool, error)
+	// Add adjusts a warm counter by delta; a cold one is left for the next Get to rebuild
+	Add(ctx context.Context, userID uuid.UUID, category string, delta int64) error
+	// Invalidate drops the cached counts so the next Get rebuilds them
+	Invalidate(ctx context.Context, userID uuid.UUID) error
+}
+
+// addIfWarmScript bumps the generation even when the cache is cold, so a
+// rebuild in flight learns about the write, but only touches an existing hash,
+// so a delta never lands on a counter that was not seeded from Postgres.
+var addIfWarmScript = redis.NewScript(`
+redis.call('INCR', KEYS[2])
+redis.call('PEXPIRE', KEYS[2], ARGV[4])
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('HINCRBY', KEYS[1], ARGV[1], ARGV[3])
+redis.call('HINCRBY', KEYS[1], ARGV[2], ARGV[3])
+return 1
+`)
+
+// setIfCurrentScript replaces the hash with the field/value pairs after ARGV[2]
+// only while the generation still equals ARGV[1].
+var setIfCurrentScript = redis.NewScript(`
+local gen = tonumber(redis.call('GET', KEYS[2]) or '0')
+if gen ~= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[1], unpack(ARGV, 3))
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+// RedisUnreadCounter keeps a hash per user with the total and one field per category.
+type RedisUnreadCounter struct {
+	client redis.Cmdable
+	ttl    time.Duration
+}
+
+func NewRedisUnreadCounter(client redis.Cmdable, ttl time.Duration) *RedisUnreadCounter {
+	if ttl <= 0 {
+		ttl = DefaultUnreadCacheTTL
+	}
+	return &RedisUnreadCounter{client: client, ttl: ttl}
+}
+
+func unreadKey(userID uuid.UUID) string {
+	return unreadKeyPrefix + userID.String()
+}
+
+func unreadGenKey(userID uuid.UUID) string {
+	return unreadGenKeyPrefix + userID.String()
+}
+
+func (r *RedisUnreadCounter) Get(ctx context.Context, userID uuid.UUID) (*model.UnreadCounts, error) {
+	fields, err := r.client.HGetAll(ctx, unreadKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	counts := &model.UnreadCounts{ByCategory: make(map[string]int64)}
+	for field, raw := range fields {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if field == unreadTotalField {
+			counts.Total = n
+		} else if category, ok := strings.CutPrefix(field, unreadCategoryPrefix); ok && n != 0 {
+			counts.ByCategory[category] = n
+		}
+	}
+	return counts, nil
+}
+
+func (r *RedisUnreadCounter) Generation(ctx context.Context, userID uuid.UUID) (int64, error) {
+	gen, err := r.client.Get(ctx, unreadGenKey(userID)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return gen, err
+}
+
+func (r *RedisUnreadCounter) Set(ctx context.Context, userID uuid.UUID, gen int64, counts model.UnreadCounts) (bool, error) {
+	args := []interface{}{gen, r.ttl.Milliseconds(), unreadTotalField, counts.Total}
+	for category, n := range counts.ByCategory {
+		args = append(args, unreadCategoryPrefix+category, n)
+	}
+	stored, err := setIfCurrentScript.Run(ctx, r.client, []string{unreadKey(userID), unreadGenKey(userID)}, args...).Int()
+	return stored == 1, err
+}
+
+func (r *RedisUnreadCounter) Add(ctx context.Context, userID uuid.UUID, category string, delta int64) error {
+	err := addIfWarmScript.Run(ctx, r.client, []string{unreadKey(userID), unreadGenKey(userID)},
+		unreadTotalField, unreadCategoryPrefix+category, delta, r.ttl.Milliseconds()).Err()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	return err
+}
+
+// Invalidate also bumps the generation, so a rebuild that counted before the
+// invalidating write cannot repopulate the cache with its stale snapshot.
+func (r *RedisUnreadCounter) Invalidate(ctx context.Context, userID uuid.UUID) error {
+	genKey := unreadGenKey(userID)
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, unreadKey(userID))
+		pipe.Incr(ctx, genKey)
+		pipe.PExpire(ctx, genKey, r.ttl)
+		return nil
+	})
+	return err
+}
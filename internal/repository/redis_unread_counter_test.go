@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"notificationService/internal/model"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestCounter(t *testing.T) *RedisUnreadCounter {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return NewRedisUnreadCounter(client, time.Minute)
+}
+
+func TestUnreadCounterIgnoresDeltasWhileCold(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCounter(t)
+	user := uuid.New()
+
+	if err := c.Add(ctx, user, "social", 1); err != nil {
+		t.Fatal(err)
+	}
+	if counts, err := c.Get(ctx, user); err != nil || counts != nil {
+		t.Fatalf("cold counter got %+v, %v, want nil", counts, err)
+	}
+
+	gen, _ := c.Generation(ctx, user)
+	if ok, err := c.Set(ctx, user, gen, model.UnreadCounts{Total: 1, ByCategory: map[string]int64{"social": 1}}); !ok || err != nil {
+		t.Fatalf("set: got %v, %v", ok, err)
+	}
+	if err := c.Add(ctx, user, "social", 2); err != nil {
+		t.Fatal(err)
+	}
+	counts, err := c.Get(ctx, user)
+	if err != nil || counts.Total != 3 || counts.ByCategory["social"] != 3 {
+		t.Fatalf("warm counter got %+v, %v, want 3 social", counts, err)
+	}
+}
+
+func TestUnreadCounterDropsStaleSnapshot(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCounter(t)
+	user := uuid.New()
+	snapshot := model.UnreadCounts{Total: 1, ByCategory: map[string]int64{"system": 1}}
+
+	for name, write := range map[string]func() error{
+		"add":        func() error { return c.Add(ctx, user, "system", 1) },
+		"invalidate": func() error { return c.Invalidate(ctx, user) },
+	} {
+		gen, err := c.Generation(ctx, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := write(); err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := c.Set(ctx, user, gen, snapshot); ok || err != nil {
+			t.Fatalf("%s: snapshot older than the write was stored (%v, %v)", name, ok, err)
+		}
+		if counts, _ := c.Get(ctx, user); counts != nil {
+			t.Fatalf("%s: stale snapshot reached the cache: %+v", name, counts)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+// Package repositorytest provides an in-memory NotificationRepository for
+// tests of the layers above Postgres.
+package repositorytest
+
+import (
+	"context"
+	"maps"
+	"notificationService/internal/model"
+	"notificationService/internal/repository"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NotificationRepository keeps notifications in a map and applies the same
+// ownership rules as the Postgres repository: rows of another user behave as
+// if they did not exist.
+type NotificationRepository struct {
+	mu       sync.Mutex
+	rows     map[uuid.UUID]model.Notification
+	attempts map[uuid.UUID]int
+}
+
+var _ repository.NotificationRepository = (*NotificationRepository)(nil)
+
+func NewNotificationRepository() *NotificationRepository {
+	return &NotificationRepository{
+		rows:     make(map[uuid.UUID]model.Notification),
+		attempts: make(map[uuid.UUID]int),
+	}
+}
+
+// Seed stores n as is, bypassing the service's validation
+func (r *NotificationRepository) Seed(n model.Notification) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rows[n.ID] = n
+}
+
+// SeedUnread stores a valid unread system notification of owner in category
+func (r *NotificationRepository) SeedUnread(owner uuid.UUID, category string) model.Notification {
+	n := model.Notification{
+		ID:        uuid.New(),
+		UserID:    owner,
+		Type:      model.TypeSystem,
+		Category:  category,
+		Priority:  model.PriorityNormal,
+		Title:     "title",
+		Body:      "body",
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+	r.Seed(n)
+	return n
+}
+
+// Row returns the stored notification regardless of its owner
+func (r *NotificationRepository) Row(id uuid.UUID) (model.Notification, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n, ok := r.rows[id]
+	return n, ok
+}
+
+// Attempts returns the recorded delivery attempts of a notification
+func (r *NotificationRepository) Attempts(id uuid.UUID) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.attempts[id]
+}
+
+func (r *NotificationRepository) Create(_ context.Context, n *model.Notification) error {
+	if n.ID == uuid.Nil {
+		n.ID = uuid.New()
+	}
+	r.Seed(*n)
+	return nil
+}
+
+func (r *NotificationRepository) CreateForUsers(_ context.Context, n *model.Notification, userIDs []uuid.UUID) ([]uuid.UUID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]uuid.UUID, len(userIDs))
+	for i, userID := range userIDs {
+		c := *n
+		c.ID, c.UserID = uuid.New(), userID
+		r.rows[c.ID] = c
+		ids[i] = c.ID
+	}
+	return ids, nil
+}
+
+func (r *NotificationRepository) FindByID(_ context.Context, userID, id uuid.UUID) (*model.Notification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n, ok := r.owned(userID, id)
+	if !ok {
+		return nil, nil
+	}
+	return &n, nil
+}
+
+func (r *NotificationRepository) FindPage(_ context.Context, userID uuid.UUID, filter model.NotificationFilter, after *model.Cursor, limit int) ([]model.Notification, error) {
+	asc := filter.Sort == model.SortAsc
+	return r.sorted(userID, asc, limit, func(n model.Notification) bool {
+		if after != nil && !beyond(n, after.CreatedAt, after.ID, asc) {
+			return false
+		}
+		return matches(n, filter)
+	}), nil
+}
+
+func (r *NotificationRepository) FindByUserIDAfter(_ context.Context, userID uuid.UUID, after time.Time, afterID uuid.UUID, limit int) ([]model.Notification, error) {
+	return r.sorted(userID, true, limit, func(n model.Notification) bool {
+		return beyond(n, after, afterID, true)
+	}), nil
+}
+
+func (r *NotificationRepository) FindUndelivered(_ context.Context, userID uuid.UUID, since time.Time, maxAttempts, limit int) ([]model.Notification, error) {
+	r.mu.Lock()
+	attempts := maps.Clone(r.attempts)
+	r.mu.Unlock()
+	return r.sorted(userID, true, limit, func(n model.Notification) bool {
+		return n.DeliveredAt == nil && !n.CreatedAt.Before(since) && attempts[n.ID] < maxAttempts
+	}), nil
+}
+
+func (r *NotificationRepository) MarkAsRead(_ context.Context, userID, id uuid.UUID, readAt time.Time) (*repository.StateChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n, ok := r.owned(userID, id)
+	if !ok {
+		return nil, nil
+	}
+	change := &repository.StateChange{Category: n.Category, WasUnread: !n.IsRead}
+	// like the COALESCE in Postgres, read_at keeps the first read time
+	if n.ReadAt == nil {
+		n.ReadAt = &readAt
+	}
+	n.IsRead = true
+	r.rows[id] = n
+	change.ReadAt = *n.ReadAt
+	return change, nil
+}
+
+func (r *NotificationRepository) MarkAllAsRead(_ context.Context, userID uuid.UUID, filter model.ReadAllFilter, readAt time.Time) (*repository.BulkChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	change := &repository.BulkChange{UnreadDelta: make(map[string]int64)}
+	for id, n := range r.rows {
+		if n.UserID != userID || n.IsRead {
+			continue
+		}
+		if filter.Type != "" && n.Type != filter.Type {
+			continue
+		}
+		if filter.Before != nil && !n.CreatedAt.Before(*filter.Before) {
+			continue
+		}
+		n.IsRead, n.ReadAt = true, &readAt
+		r.rows[id] = n
+		change.IDs = append(change.IDs, id)
+		change.UnreadDelta[n.Category]--
+	}
+	return change, nil
+}
+
+func (r *NotificationRepository) SetRead(_ context.Context, userID uuid.UUID, ids []uuid.UUID, read bool, at time.Time) (*repository.BulkChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	change := &repository.BulkChange{UnreadDelta: make(map[string]int64)}
+	for _, id := range ids {
+		n, ok := r.owned(userID, id)
+		if !ok || n.IsRead == read {
+			continue
+		}
+		n.IsRead = read
+		if read {
+			n.ReadAt = &at
+			change.UnreadDelta[n.Category]--
+		} else {
+			n.ReadAt = nil
+			change.UnreadDelta[n.Category]++
+		}
+		r.rows[id] = n
+		change.IDs = append(change.IDs, id)
+	}
+	return change, nil
+}
+
+func (r *NotificationRepository) DeleteMany(_ context.Context, userID uuid.UUID, ids []uuid.UUID) (*repository.BulkChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	change := &repository.BulkChange{UnreadDelta: make(map[string]int64)}
+	for _, id := range ids {
+		n, ok := r.owned(userID, id)
+		if !ok {
+			continue
+		}
+		delete(r.rows, id)
+		change.IDs = append(change.IDs, id)
+		if !n.IsRead {
+			change.UnreadDelta[n.Category]--
+		}
+	}
+	return change, nil
+}
+
+func (r *NotificationRepository) MarkDelivered(_ context.Context, userID, id uuid.UUID, deliveredAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n, ok := r.owned(userID, id)
+	if !ok || n.DeliveredAt != nil {
+		return false, nil
+	}
+	n.DeliveredAt = &deliveredAt
+	r.rows[id] = n
+	return true, nil
+}
+
+func (r *NotificationRepository) IncrementDeliveryAttempts(_ context.Context, userID uuid.UUID, attempts map[uuid.UUID]int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, n := range attempts {
+		if _, ok := r.owned(userID, id); ok {
+			r.attempts[id] += n
+		}
+	}
+	return nil
+}
+
+func (r *NotificationRepository) CountUnread(ctx context.Context, userID uuid.UUID) (int64, error) {
+	counts, err := r.CountUnreadByCategory(ctx, userID)
+	return counts.Total, err
+}
+
+func (r *NotificationRepository) CountUnreadByCategory(_ context.Context, userID uuid.UUID) (model.UnreadCounts, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := model.UnreadCounts{ByCategory: make(map[string]int64)}
+	for _, n := range r.rows {
+		if n.UserID == userID && !n.IsRead {
+			counts.Total++
+			counts.ByCategory[n.Category]++
+		}
+	}
+	return counts, nil
+}
+
+func (r *NotificationRepository) Delete(_ context.Context, userID, id uuid.UUID) (*repository.StateChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n, ok := r.owned(userID, id)
+	if !ok {
+		return nil, nil
+	}
+	delete(r.rows, id)
+	return &repository.StateChange{Category: n.Category, WasUnread: !n.IsRead}, nil
+}
+
+// owned returns the row only when it belongs to userID. Callers hold r.mu.
+func (r *NotificationRepository) owned(userID, id uuid.UUID) (model.Notification, bool) {
+	n, ok := r.rows[id]
+	if !ok || n.UserID != userID {
+		return model.Notification{}, false
+	}
+	return n, true
+}
+
+// sorted returns up to limit of the user's rows accepted by keep, ordered by (created_at, id)
+func (r *NotificationRepository) sorted(userID uuid.UUID, asc bool, limit int, keep func(model.Notification) bool) []model.Notification {
+	r.mu.Lock()
+	var out []model.Notification
+	for _, n := range r.rows {
+		if n.UserID == userID && keep(n) {
+			out = append(out, n)
+		}
+	}
+	r.mu.Unlock()
+
+	slices.SortFunc(out, func(a, b model.Notification) int {
+		c := a.CreatedAt.Compare(b.CreatedAt)
+		if c == 0 {
+			c = compareUUID(a.ID, b.ID)
+		}
+		if !asc {
+			c = -c
+		}
+		return c
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// beyond reports whether n sorts after the (at, id) key in the given direction
+func beyond(n model.Notification, at time.Time, id uuid.UUID, asc bool) bool {
+	c := n.CreatedAt.Compare(at)
+	if c == 0 {
+		c = compareUUID(n.ID, id)
+	}
+	if asc {
+		return c > 0
+	}
+	return c < 0
+}
+
+func matches(n model.Notification, f model.NotificationFilter) bool {
+	if f.Read != nil && n.IsRead != *f.Read {
+		return false
+	}
+	if len(f.Types) > 0 && !slices.Contains(f.Types, n.Type) {
+		return false
+	}
+	if len(f.Categories) > 0 && !slices.Contains(f.Categories, n.Category) {
+		return false
+	}
+	if len(f.Priorities) > 0 && !slices.Contains(f.Priorities, n.Priority) {
+		return false
+	}
+	if f.ActorID != nil && (n.ActorID == nil || *n.ActorID != *f.ActorID) {
+		return false
+	}
+	if f.CreatedFrom != nil && n.CreatedAt.Before(*f.CreatedFrom) {
+		return false
+	}
+	if f.CreatedTo != nil && !n.CreatedAt.Before(*f.CreatedTo) {
+		return false
+	}
+	return true
+}
+
+func compareUUID(a, b uuid.UUID) int {
+	return slices.Compare(a[:], b[:])
+}
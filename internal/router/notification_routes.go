@@ -1,17 +1,36 @@
 package router
 
 import (
+	"github.com/Sayan80bayev/go-project/pkg/middleware"
 	"github.com/gin-gonic/gin"
+	"notificationService/internal/auth"
 	"notificationService/internal/delivery"
 	"notificationService/internal/service"
 )
 
-func RegisterNotificationRoutes(r *gin.Engine, svc service.NotificationService) {
+// RegisterNotificationRoutes mounts the user-facing routes behind the shared
+// token verifier. /ws/message pushes to arbitrary users, so it is reserved
+// for service accounts holding pushGrant as a role or scope.
+func RegisterNotificationRoutes(r *gin.Engine, svc service.NotificationService, verifier *auth.Verifier, pushGrant string) {
 	h := delivery.NewNotificationHandler(svc)
-	r.POST("/", h.CreateNotification)
-	r.POST("/ws/message", h.SendMessageWS)
-	r.GET("/", h.GetUserNotifications)
-	r.GET("/:id", h.GetNotificationByID)
-	r.PATCH("/:id/read", h.MarkNotificationAsRead)
-	r.DELETE("/:id", h.DeleteNotification)
+
+	user := r.Group("/", auth.Authenticate(verifier))
+	user.POST("/", h.CreateNotification)
+	user.GET("/", h.GetUserNotifications)
+	user.GET("/unread-count", h.GetUnreadCount)
+	user.GET("/:id", h.GetNotificationByID)
+	user.PATCH("/:id/read", h.MarkNotificationAsRead)
+	user.POST("/read-all", h.ReadAll)
+	user.POST("/bulk/read", h.BulkMarkRead)
+	user.POST("/bulk/unread", h.BulkMarkUnread)
+	user.POST("/bulk/delete", h.BulkDelete)
+	user.DELETE("/:id", h.DeleteNotification)
+
+	r.POST("/ws/message", auth.Authenticate(verifier), auth.RequireServiceAccount(pushGrant), h.SendMessageWS)
+}
+
+func RegisterAdminRoutes(r *gin.Engine, svc service.NotificationService, verifier *auth.Verifier) {
+	h := delivery.NewNotificationHandler(svc)
+	admin := r.Group("/admin", auth.Authenticate(verifier), auth.RequireRoles(middleware.RoleAdmin))
+	admin.POST("/broadcast", h.Broadcast)
 }
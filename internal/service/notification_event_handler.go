@@ -29,9 +29,13 @@ func HandleSubscriptionCreated(svc NotificationService) func(data []byte) error
 		}
 
 		logger.Infof("Subscription Created: Follower=%s Followee=%s CreatedAt=%d", evt.FollowerID, evt.FolloweeID, evt.CreatedAt)
+		followerID := evt.FollowerID
 		notification := &model.Notification{
 			UserID:  evt.FolloweeID,
-			Message: fmt.Sprintf("You have a new follower! %s, %d", evt.FollowerID, evt.CreatedAt),
+			Type:    model.TypeFollow,
+			Title:   "New follower",
+			Body:    fmt.Sprintf("You have a new follower! %s, %d", evt.FollowerID, evt.CreatedAt),
+			ActorID: &followerID,
 		}
 
 		res, err := svc.CreateNotification(context.Background(), notification)
@@ -39,7 +43,12 @@ func HandleSubscriptionCreated(svc NotificationService) func(data []byte) error
 			return err
 		}
 
-		ws.SendNotification(res.UserID, res.Message)
+		ws.SendNotification(res.UserID, res)
+		if count, err := svc.CountUnread(context.Background(), res.UserID); err == nil {
+			ws.SendEvent(res.UserID, ws.EventUnreadCount, "", ws.UnreadCountPayload{Count: count})
+		} else {
+			logger.Warnf("unread count for user %s failed: %v", res.UserID, err)
+		}
 		return nil
 	}
 }
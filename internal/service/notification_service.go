@@ -2,35 +2,63 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/Sayan80bayev/go-project/pkg/logging"
 	"notificationService/internal/model"
 	"notificationService/internal/repository"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 )
 
 var (
-	ErrInvalidID      = errors.New("invalid notification id")
-	ErrInvalidUserID  = errors.New("invalid user id")
-	ErrMissingTitle   = errors.New("notification title is required")
-	ErrMissingMessage = errors.New("notification message is required")
+	ErrInvalidID       = errors.New("invalid notification id")
+	ErrInvalidUserID   = errors.New("invalid user id")
+	ErrMissingTitle    = errors.New("notification title is required")
+	ErrMissingMessage  = errors.New("notification body is required")
+	ErrUnknownType     = errors.New("unknown notification type")
+	ErrInvalidPriority = errors.New("invalid notification priority")
+	ErrInvalidTarget   = errors.New("notification target needs both type and id")
+	ErrInvalidMetadata = errors.New("notification metadata must be a JSON object")
+	ErrFieldTooLong    = errors.New("notification field too long")
+	ErrInvalidCursor   = errors.New("invalid page cursor")
+	ErrNoIDs           = errors.New("at least one notification id is required")
+	ErrTooManyIDs      = fmt.Errorf("at most %d notification ids per request", MaxBulkIDs)
+	// ErrNotFound covers both missing and foreign notifications so IDs cannot be probed
+	ErrNotFound = model.ErrNotFound
 )
 
 type NotificationService interface {
 	CreateNotification(ctx context.Context, n *model.Notification) (*model.Notification, error)
-	GetNotificationByID(ctx context.Context, id uuid.UUID) (*model.Notification, error)
-	GetNotificationsByUser(ctx context.Context, userID uuid.UUID, limit, offset int) ([]model.Notification, error)
-	MarkNotificationAsRead(ctx context.Context, id uuid.UUID) error
-	DeleteNotification(ctx context.Context, id uuid.UUID) error
+	CreateNotificationForUsers(ctx context.Context, n *model.Notification, userIDs []uuid.UUID) ([]model.Notification, error)
+	GetNotificationByID(ctx context.Context, userID, id uuid.UUID) (*model.Notification, error)
+	GetNotificationsByUser(ctx context.Context, userID uuid.UUID, filter model.NotificationFilter, cursor string, limit int) (*model.NotificationPage, error)
+	GetNotificationsAfter(ctx context.Context, userID uuid.UUID, after time.Time, afterID uuid.UUID, limit int) ([]model.Notification, error)
+	MarkNotificationAsRead(ctx context.Context, userID, id uuid.UUID) (time.Time, error)
+	MarkAllNotificationsAsRead(ctx context.Context, userID uuid.UUID, filter model.ReadAllFilter) (int64, error)
+	SetNotificationsRead(ctx context.Context, userID uuid.UUID, ids []uuid.UUID, read bool) ([]uuid.UUID, error)
+	DeleteNotifications(ctx context.Context, userID uuid.UUID, ids []uuid.UUID) ([]uuid.UUID, error)
+	CountUnread(ctx context.Context, userID uuid.UUID) (int64, error)
+	GetUnreadCounts(ctx context.Context, userID uuid.UUID) (*model.UnreadCounts, error)
+	ReconcileUnreadCounts(ctx context.Context, userID uuid.UUID) (*model.UnreadCounts, error)
+	GetUndeliveredNotifications(ctx context.Context, userID uuid.UUID, since time.Time, maxAttempts, limit int) ([]model.Notification, error)
+	MarkNotificationDelivered(ctx context.Context, userID, id uuid.UUID) (bool, error)
+	RecordDeliveryAttempts(ctx context.Context, userID uuid.UUID, attempts map[uuid.UUID]int) error
+	DeleteNotification(ctx context.Context, userID, id uuid.UUID) error
 }
 
 type notificationService struct {
 	repo repository.NotificationRepository
+	// unread caches badge counts; nil counts straight from Postgres
+	unread repository.UnreadCounter
 }
 
-func NewNotificationService(repo repository.NotificationRepository) NotificationService {
-	return &notificationService{repo: repo}
+func NewNotificationService(repo repository.NotificationRepository, unread repository.UnreadCounter) NotificationService {
+	return &notificationService{repo: repo, unread: unread}
 }
 
 // CreateNotification adds a new notification securely
@@ -41,54 +69,487 @@ func (s *notificationService) CreateNotification(ctx context.Context, n *model.N
 	if n.UserID == uuid.Nil {
 		return nil, ErrInvalidUserID
 	}
-	if n.Message == "" {
-		return nil, ErrMissingMessage
+	if err := normalize(n); err != nil {
+		return nil, err
 	}
 	n.ID = uuid.New()
-	n.CreatedAt = time.Now().UTC()
+	// Postgres keeps microseconds; truncating keeps pushed and stored timestamps identical,
+	// which resume cursors rely on.
+	n.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
 	n.IsRead = false
 	n.ReadAt = nil
 
 	if err := s.repo.Create(ctx, n); err != nil {
 		return nil, err
 	}
+	s.adjustUnread(ctx, n.UserID, n.Category, 1)
 	return n, nil
 }
 
-// GetNotificationByID fetches a single notification
-func (s *notificationService) GetNotificationByID(ctx context.Context, id uuid.UUID) (*model.Notification, error) {
+// CreateNotificationForUsers stores a copy of n for each distinct user in one
+// write, so a failure stores none and a retry cannot duplicate; it returns the
+// copies in user order
+func (s *notificationService) CreateNotificationForUsers(ctx context.Context, n *model.Notification, userIDs []uuid.UUID) ([]model.Notification, error) {
+	if n == nil {
+		return nil, errors.New("notification cannot be nil")
+	}
+	users := make([]uuid.UUID, 0, len(userIDs))
+	seen := make(map[uuid.UUID]struct{}, len(userIDs))
+	for _, id := range userIDs {
+		if id == uuid.Nil {
+			return nil, ErrInvalidUserID
+		}
+		if _, dup := seen[id]; !dup {
+			seen[id] = struct{}{}
+			users = append(users, id)
+		}
+	}
+	if err := normalize(n); err != nil {
+		return nil, err
+	}
+	n.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	n.IsRead = false
+	n.ReadAt = nil
+
+	ids, err := s.repo.CreateForUsers(ctx, n, users)
+	if err != nil {
+		return nil, err
+	}
+	created := make([]model.Notification, len(users))
+	for i, userID := range users {
+		created[i] = *n
+		created[i].ID, created[i].UserID = ids[i], userID
+		s.adjustUnread(ctx, userID, n.Category, 1)
+	}
+	return created, nil
+}
+
+// column widths from the notifications table, in characters
+const (
+	maxTitleLength      = 255
+	maxCategoryLength   = 50
+	maxTargetTypeLength = 50
+	maxTargetIDLength   = 255
+)
+
+// normalize validates a new notification and fills in the defaults of its type
+func normalize(n *model.Notification) error {
+	if n.Title == "" {
+		return ErrMissingTitle
+	}
+	if n.Body == "" {
+		return ErrMissingMessage
+	}
+	if n.Type == "" {
+		n.Type = model.TypeSystem
+	}
+	info, ok := model.LookupType(n.Type)
+	if !ok {
+		return ErrUnknownType
+	}
+	if n.Category == "" {
+		n.Category = info.Category
+	}
+	if n.Priority == "" {
+		n.Priority = info.Priority
+	}
+	if !n.Priority.Valid() {
+		return ErrInvalidPriority
+	}
+	if n.Target != nil && (n.Target.Type == "" || n.Target.ID == "") {
+		return ErrInvalidTarget
+	}
+	if err := checkLength("title", n.Title, maxTitleLength); err != nil {
+		return err
+	}
+	if err := checkLength("category", n.Category, maxCategoryLength); err != nil {
+		return err
+	}
+	if n.Target != nil {
+		if err := checkLength("target type", n.Target.Type, maxTargetTypeLength); err != nil {
+			return err
+		}
+		if err := checkLength("target id", n.Target.ID, maxTargetIDLength); err != nil {
+			return err
+		}
+	}
+	if len(n.Metadata) == 0 || string(n.Metadata) == "null" {
+		n.Metadata = json.RawMessage(`{}`)
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(n.Metadata, &obj); err != nil || obj == nil {
+		return ErrInvalidMetadata
+	}
+	return nil
+}
+
+// checkLength rejects values longer than their column instead of letting
+// Postgres fail the insert
+func checkLength(field, value string, max int) error {
+	if utf8.RuneCountInString(value) > max {
+		return fmt.Errorf("%w: %s exceeds %d characters", ErrFieldTooLong, field, max)
+	}
+	return nil
+}
+
+// GetNotificationByID fetches a single notification owned by the user
+func (s *notificationService) GetNotificationByID(ctx context.Context, userID, id uuid.UUID) (*model.Notification, error) {
 	if id == uuid.Nil {
 		return nil, ErrInvalidID
 	}
-	return s.repo.FindByID(ctx, id)
+	if userID == uuid.Nil {
+		return nil, ErrInvalidUserID
+	}
+	n, err := s.repo.FindByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if n == nil {
+		return nil, ErrNotFound
+	}
+	return n, nil
+}
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// GetNotificationsByUser fetches a page of notifications matching filter, newest
+// first unless it asks otherwise, starting after the opaque cursor returned with
+// the previous page (empty for the first)
+func (s *notificationService) GetNotificationsByUser(ctx context.Context, userID uuid.UUID, filter model.NotificationFilter, cursor string, limit int) (*model.NotificationPage, error) {
+	if userID == uuid.Nil {
+		return nil, ErrInvalidUserID
+	}
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	limit = min(limit, maxPageSize)
+	if filter.Sort == "" {
+		filter.Sort = model.SortDesc
+	}
+	asc := filter.Sort == model.SortAsc
+
+	var after *model.Cursor
+	if cursor != "" {
+		decoded, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		// a cursor from the other direction would skip the rows in between
+		if decoded.Asc != asc {
+			return nil, ErrInvalidCursor
+		}
+		after = decoded
+	}
+
+	// one extra row tells whether another page follows
+	items, err := s.repo.FindPage(ctx, userID, filter, after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	page := &model.NotificationPage{Items: items}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.HasMore = true
+		last := page.Items[limit-1]
+		page.NextCursor = encodeCursor(model.Cursor{CreatedAt: last.CreatedAt, ID: last.ID, Asc: asc})
+	}
+	if page.Items == nil {
+		page.Items = []model.Notification{}
+	}
+	return page, nil
 }
 
-// GetNotificationsByUser fetches notifications with pagination
-func (s *notificationService) GetNotificationsByUser(ctx context.Context, userID uuid.UUID, limit, offset int) ([]model.Notification, error) {
+// encodeCursor makes a page key opaque so clients pass it back untouched
+func encodeCursor(c model.Cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(raw string) (*model.Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c model.Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.CreatedAt.IsZero() || c.ID == uuid.Nil {
+		return nil, ErrInvalidCursor
+	}
+	c.CreatedAt = c.CreatedAt.UTC()
+	return &c, nil
+}
+
+// GetNotificationsAfter fetches notifications newer than the given cursor, oldest first.
+// A nil afterID means everything strictly after the timestamp.
+func (s *notificationService) GetNotificationsAfter(ctx context.Context, userID uuid.UUID, after time.Time, afterID uuid.UUID, limit int) ([]model.Notification, error) {
 	if userID == uuid.Nil {
 		return nil, ErrInvalidUserID
 	}
 	if limit <= 0 {
-		limit = 20
+		limit = 100
 	}
-	if offset < 0 {
-		offset = 0
+	if afterID == uuid.Nil {
+		afterID = uuid.Max
 	}
-	return s.repo.FindByUserID(ctx, userID, limit, offset)
+	return s.repo.FindByUserIDAfter(ctx, userID, after.UTC(), afterID, limit)
 }
 
-// MarkNotificationAsRead marks a notification as read
-func (s *notificationService) MarkNotificationAsRead(ctx context.Context, id uuid.UUID) error {
+// MarkNotificationAsRead marks a notification owned by the user as read
+func (s *notificationService) MarkNotificationAsRead(ctx context.Context, userID, id uuid.UUID) (time.Time, error) {
 	if id == uuid.Nil {
+		return time.Time{}, ErrInvalidID
+	}
+	if userID == uuid.Nil {
+		return time.Time{}, ErrInvalidUserID
+	}
+	change, err := s.repo.MarkAsRead(ctx, userID, id, time.Now().UTC())
+	if err != nil {
+		return time.Time{}, err
+	}
+	if change == nil {
+		return time.Time{}, ErrNotFound
+	}
+	if change.WasUnread {
+		s.adjustUnread(ctx, userID, change.Category, -1)
+	}
+	return change.ReadAt.UTC(), nil
+}
+
+// MarkAllNotificationsAsRead marks all of a user's notifications matching filter as read
+func (s *notificationService) MarkAllNotificationsAsRead(ctx context.Context, userID uuid.UUID, filter model.ReadAllFilter) (int64, error) {
+	if userID == uuid.Nil {
+		return 0, ErrInvalidUserID
+	}
+	if filter.Type != "" && !filter.Type.Valid() {
+		return 0, ErrUnknownType
+	}
+	change, err := s.repo.MarkAllAsRead(ctx, userID, filter, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	s.applyUnreadDelta(ctx, userID, change.UnreadDelta)
+	return int64(len(change.IDs)), nil
+}
+
+// MaxBulkIDs bounds the ID list of a bulk request
+const MaxBulkIDs = 500
+
+// SetNotificationsRead marks the listed notifications of a user read or unread
+// and returns the IDs whose state changed; foreign IDs are silently skipped
+func (s *notificationService) SetNotificationsRead(ctx context.Context, userID uuid.UUID, ids []uuid.UUID, read bool) ([]uuid.UUID, error) {
+	ids, err := bulkIDs(userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	change, err := s.repo.SetRead(ctx, userID, ids, read, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	s.applyUnreadDelta(ctx, userID, change.UnreadDelta)
+	return change.IDs, nil
+}
+
+// DeleteNotifications removes the listed notifications of a user and returns
+// the IDs that were deleted; foreign IDs are silently skipped
+func (s *notificationService) DeleteNotifications(ctx context.Context, userID uuid.UUID, ids []uuid.UUID) ([]uuid.UUID, error) {
+	ids, err := bulkIDs(userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	change, err := s.repo.DeleteMany(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	s.applyUnreadDelta(ctx, userID, change.UnreadDelta)
+	return change.IDs, nil
+}
+
+// bulkIDs validates and de-duplicates the ID list of a bulk request
+func bulkIDs(userID uuid.UUID, ids []uuid.UUID) ([]uuid.UUID, error) {
+	if userID == uuid.Nil {
+		return nil, ErrInvalidUserID
+	}
+	if len(ids) == 0 {
+		return nil, ErrNoIDs
+	}
+	if len(ids) > MaxBulkIDs {
+		return nil, ErrTooManyIDs
+	}
+	seen := make(map[uuid.UUID]struct{}, len(ids))
+	unique := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if id == uuid.Nil {
+			return nil, ErrInvalidID
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		unique = append(unique, id)
+	}
+	return unique, nil
+}
+
+// CountUnread returns the number of unread notifications of a user
+func (s *notificationService) CountUnread(ctx context.Context, userID uuid.UUID) (int64, error) {
+	if userID == uuid.Nil {
+		return 0, ErrInvalidUserID
+	}
+	if s.unread == nil {
+		return s.repo.CountUnread(ctx, userID)
+	}
+	counts, err := s.GetUnreadCounts(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return counts.Total, nil
+}
+
+// GetUnreadCounts returns a user's unread total and per-category split from the
+// cache, rebuilding it from Postgres when it is cold, unreachable or has drifted
+func (s *notificationService) GetUnreadCounts(ctx context.Context, userID uuid.UUID) (*model.UnreadCounts, error) {
+	if userID == uuid.Nil {
+		return nil, ErrInvalidUserID
+	}
+	if s.unread == nil {
+		counts, err := s.repo.CountUnreadByCategory(ctx, userID)
+		return &counts, err
+	}
+	counts, err := s.unread.Get(ctx, userID)
+	if err != nil {
+		logging.GetLogger().Warnf("unread cache read for user %s failed: %v", userID, err)
+		counts, err := s.repo.CountUnreadByCategory(ctx, userID)
+		return &counts, err
+	}
+	if counts == nil || drifted(counts) {
+		return s.ReconcileUnreadCounts(ctx, userID)
+	}
+	return counts, nil
+}
+
+// ReconcileUnreadCounts recounts a user's unread notifications in Postgres and
+// overwrites the cached counters with the result, unless a write raced the
+// recount; the cache then stays as the write left it and a later read rebuilds it
+func (s *notificationService) ReconcileUnreadCounts(ctx context.Context, userID uuid.UUID) (*model.UnreadCounts, error) {
+	if userID == uuid.Nil {
+		return nil, ErrInvalidUserID
+	}
+	var gen int64
+	cache := s.unread != nil
+	if cache {
+		var err error
+		if gen, err = s.unread.Generation(ctx, userID); err != nil {
+			logging.GetLogger().Warnf("unread cache generation for user %s failed: %v", userID, err)
+			cache = false
+		}
+	}
+	counts, err := s.repo.CountUnreadByCategory(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if cache {
+		if _, err := s.unread.Set(ctx, userID, gen, counts); err != nil {
+			logging.GetLogger().Warnf("unread cache refresh for user %s failed: %v", userID, err)
+		}
+	}
+	return &counts, nil
+}
+
+// drifted reports counters that cannot be right: negative values or
+// categories that do not add up to the total
+func drifted(counts *model.UnreadCounts) bool {
+	if counts.Total < 0 {
+		return true
+	}
+	var sum int64
+	for _, n := range counts.ByCategory {
+		if n < 0 {
+			return true
+		}
+		sum += n
+	}
+	return sum != counts.Total
+}
+
+// adjustUnread moves a cached counter after a committed write. A failed update
+// drops the cache instead, so the next read recounts rather than serving a wrong badge.
+func (s *notificationService) adjustUnread(ctx context.Context, userID uuid.UUID, category string, delta int64) {
+	if s.unread == nil {
+		return
+	}
+	if err := s.unread.Add(ctx, userID, category, delta); err != nil {
+		logging.GetLogger().Warnf("unread cache update for user %s failed: %v", userID, err)
+		s.invalidateUnread(ctx, userID)
+	}
+}
+
+func (s *notificationService) applyUnreadDelta(ctx context.Context, userID uuid.UUID, delta map[string]int64) {
+	for category, n := range delta {
+		s.adjustUnread(ctx, userID, category, n)
+	}
+}
+
+func (s *notificationService) invalidateUnread(ctx context.Context, userID uuid.UUID) {
+	if s.unread == nil {
+		return
+	}
+	if err := s.unread.Invalidate(ctx, userID); err != nil {
+		logging.GetLogger().Warnf("unread cache invalidation for user %s failed: %v", userID, err)
+	}
+}
+
+// GetUndeliveredNotifications fetches unacknowledged notifications that may still be retried
+func (s *notificationService) GetUndeliveredNotifications(ctx context.Context, userID uuid.UUID, since time.Time, maxAttempts, limit int) ([]model.Notification, error) {
+	if userID == uuid.Nil {
+		return nil, ErrInvalidUserID
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+	return s.repo.FindUndelivered(ctx, userID, since.UTC(), maxAttempts, limit)
+}
+
+// MarkNotificationDelivered stores the delivery acknowledgement, reporting whether it was the first one
+func (s *notificationService) MarkNotificationDelivered(ctx context.Context, userID, id uuid.UUID) (bool, error) {
+	if id == uuid.Nil {
+		return false, ErrInvalidID
+	}
+	if userID == uuid.Nil {
+		return false, ErrInvalidUserID
+	}
+	return s.repo.MarkDelivered(ctx, userID, id, time.Now().UTC())
+}
+
+// RecordDeliveryAttempts counts pushes towards the retry limit, keyed by notification ID
+func (s *notificationService) RecordDeliveryAttempts(ctx context.Context, userID uuid.UUID, attempts map[uuid.UUID]int) error {
+	if userID == uuid.Nil {
+		return ErrInvalidUserID
+	}
+	if _, ok := attempts[uuid.Nil]; ok {
 		return ErrInvalidID
 	}
-	return s.repo.MarkAsRead(ctx, id, time.Now().UTC())
+	return s.repo.IncrementDeliveryAttempts(ctx, userID, attempts)
 }
 
-// DeleteNotification removes a notification
-func (s *notificationService) DeleteNotification(ctx context.Context, id uuid.UUID) error {
+// DeleteNotification removes a notification owned by the user
+func (s *notificationService) DeleteNotification(ctx context.Context, userID, id uuid.UUID) error {
 	if id == uuid.Nil {
 		return ErrInvalidID
 	}
-	return s.repo.Delete(ctx, id)
+	if userID == uuid.Nil {
+		return ErrInvalidUserID
+	}
+	change, err := s.repo.Delete(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if change == nil {
+		return ErrNotFound
+	}
+	if change.WasUnread {
+		s.adjustUnread(ctx, userID, change.Category, -1)
+	}
+	return nil
 }
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"notificationService/internal/model"
+	"notificationService/internal/repository"
+	"notificationService/internal/repository/repositorytest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+func newUnreadCounter(t *testing.T) *repository.RedisUnreadCounter {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return repository.NewRedisUnreadCounter(client, time.Minute)
+}
+
+func TestNormalize(t *testing.T) {
+	valid := func() model.Notification { return model.Notification{Title: "t", Body: "b"} }
+	for _, tc := range []struct {
+		name   string
+		modify func(*model.Notification)
+		err    error
+	}{
+		{"defaults", func(*model.Notification) {}, nil},
+		{"missing title", func(n *model.Notification) { n.Title = "" }, ErrMissingTitle},
+		{"missing body", func(n *model.Notification) { n.Body = "" }, ErrMissingMessage},
+		{"unknown type", func(n *model.Notification) { n.Type = "nope" }, ErrUnknownType},
+		{"invalid priority", func(n *model.Notification) { n.Priority = "meh" }, ErrInvalidPriority},
+		{"half a target", func(n *model.Notification) { n.Target = &model.TargetRef{Type: "post"} }, ErrInvalidTarget},
+		{"metadata not an object", func(n *model.Notification) { n.Metadata = []byte(`[1]`) }, ErrInvalidMetadata},
+		{"title at the limit in runes", func(n *model.Notification) { n.Title = strings.Repeat("é", 255) }, nil},
+		{"title too long", func(n *model.Notification) { n.Title = strings.Repeat("a", 256) }, ErrFieldTooLong},
+		{"category too long", func(n *model.Notification) { n.Category = strings.Repeat("a", 51) }, ErrFieldTooLong},
+		{"target type too long", func(n *model.Notification) { n.Target = &model.TargetRef{Type: strings.Repeat("a", 51), ID: "1"} }, ErrFieldTooLong},
+		{"target id too long", func(n *model.Notification) { n.Target = &model.TargetRef{Type: "post", ID: strings.Repeat("1", 256)} }, ErrFieldTooLong},
+	} {
+		n := valid()
+		tc.modify(&n)
+		if err := normalize(&n); !errors.Is(err, tc.err) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.err)
+		}
+	}
+
+	n := valid()
+	if err := normalize(&n); err != nil || n.Type != model.TypeSystem || n.Category != "system" || n.Priority != model.PriorityNormal || string(n.Metadata) != "{}" {
+		t.Fatalf("defaults: got %+v, %v", n, err)
+	}
+}
+
+func TestForeignNotificationsAreNotFound(t *testing.T) {
+	ctx := context.Background()
+	repo := repositorytest.NewNotificationRepository()
+	svc := NewNotificationService(repo, nil)
+	owner, intruder := uuid.New(), uuid.New()
+	n := repo.SeedUnread(owner, "system")
+
+	if _, err := svc.GetNotificationByID(ctx, intruder, n.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get: got %v, want ErrNotFound", err)
+	}
+	if _, err := svc.MarkNotificationAsRead(ctx, intruder, n.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("mark read: got %v, want ErrNotFound", err)
+	}
+	if err := svc.DeleteNotification(ctx, intruder, n.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("delete: got %v, want ErrNotFound", err)
+	}
+	if ids, err := svc.DeleteNotifications(ctx, intruder, []uuid.UUID{n.ID}); err != nil || len(ids) != 0 {
+		t.Fatalf("bulk delete: got %v, %v, want nothing deleted", ids, err)
+	}
+
+	row, ok := repo.Row(n.ID)
+	if !ok || row.IsRead {
+		t.Fatalf("foreign calls changed the row: present=%v read=%v", ok, row.IsRead)
+	}
+	if _, err := svc.GetNotificationByID(ctx, owner, n.ID); err != nil {
+		t.Fatalf("owner lost access: %v", err)
+	}
+}
+
+func TestMarkAsReadReportsStoredReadTime(t *testing.T) {
+	ctx := context.Background()
+	repo := repositorytest.NewNotificationRepository()
+	svc := NewNotificationService(repo, nil)
+	n := repo.SeedUnread(uuid.New(), "system")
+
+	first, err := svc.MarkNotificationAsRead(ctx, n.UserID, n.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := svc.MarkNotificationAsRead(ctx, n.UserID, n.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, _ := repo.Row(n.ID)
+	if row.ReadAt == nil || !first.Equal(*row.ReadAt) || !again.Equal(first) {
+		t.Fatalf("read_at reported %v then %v, stored %v; want the first read time each time", first, again, row.ReadAt)
+	}
+}
+
+func TestRecordDeliveryAttemptsIgnoresForeignIDs(t *testing.T) {
+	ctx := context.Background()
+	repo := repositorytest.NewNotificationRepository()
+	svc := NewNotificationService(repo, nil)
+	owner := uuid.New()
+	mine, theirs := repo.SeedUnread(owner, "system"), repo.SeedUnread(uuid.New(), "system")
+
+	err := svc.RecordDeliveryAttempts(ctx, owner, map[uuid.UUID]int{mine.ID: 2, theirs.ID: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := repo.Attempts(mine.ID); got != 2 {
+		t.Fatalf("own notification has %d attempts, want 2", got)
+	}
+	if got := repo.Attempts(theirs.ID); got != 0 {
+		t.Fatalf("foreign notification has %d attempts, want 0", got)
+	}
+}
+
+func TestGetNotificationsByUserPages(t *testing.T) {
+	ctx := context.Background()
+	repo := repositorytest.NewNotificationRepository()
+	svc := NewNotificationService(repo, nil)
+	user := uuid.New()
+	for i := 0; i < 5; i++ {
+		repo.SeedUnread(user, "system")
+	}
+	repo.SeedUnread(uuid.New(), "system")
+
+	seen := make(map[uuid.UUID]bool)
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("pagination did not terminate")
+		}
+		page, err := svc.GetNotificationsByUser(ctx, user, model.NotificationFilter{}, cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range page.Items {
+			if n.UserID != user || seen[n.ID] {
+				t.Fatalf("page returned foreign or repeated notification %s", n.ID)
+			}
+			seen[n.ID] = true
+		}
+		if !page.HasMore {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if len(seen) != 5 {
+		t.Fatalf("paged through %d notifications, want 5", len(seen))
+	}
+
+	asc := model.NotificationFilter{Sort: model.SortAsc}
+	first, _ := svc.GetNotificationsByUser(ctx, user, model.NotificationFilter{}, "", 2)
+	if _, err := svc.GetNotificationsByUser(ctx, user, asc, first.NextCursor, 2); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("cursor reused across sort orders: got %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestUnreadCountsFollowWrites(t *testing.T) {
+	ctx := context.Background()
+	repo := repositorytest.NewNotificationRepository()
+	svc := NewNotificationService(repo, newUnreadCounter(t))
+	user := uuid.New()
+	social := repo.SeedUnread(user, "social")
+	repo.SeedUnread(user, "system")
+
+	counts, err := svc.GetUnreadCounts(ctx, user)
+	if err != nil || counts.Total != 2 {
+		t.Fatalf("cold read: got %+v, %v, want total 2", counts, err)
+	}
+
+	if _, err := svc.MarkNotificationAsRead(ctx, user, social.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.CreateNotification(ctx, &model.Notification{UserID: user, Title: "t", Body: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	counts, err = svc.GetUnreadCounts(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts.Total != 2 || counts.ByCategory["social"] != 0 || counts.ByCategory["system"] != 2 {
+		t.Fatalf("warm read: got %+v, want 2 unread system notifications", counts)
+	}
+}
+
+// racingRepository lets a write land between the recount and the cache refill
+type racingRepository struct {
+	*repositorytest.NotificationRepository
+	afterCount func()
+}
+
+func (r *racingRepository) CountUnreadByCategory(ctx context.Context, userID uuid.UUID) (model.UnreadCounts, error) {
+	counts, err := r.NotificationRepository.CountUnreadByCategory(ctx, userID)
+	if hook := r.afterCount; hook != nil {
+		r.afterCount = nil
+		hook()
+	}
+	return counts, err
+}
+
+func TestReconcileDropsSnapshotRacedByWrite(t *testing.T) {
+	ctx := context.Background()
+	repo := &racingRepository{NotificationRepository: repositorytest.NewNotificationRepository()}
+	svc := NewNotificationService(repo, newUnreadCounter(t))
+	user := uuid.New()
+	repo.NotificationRepository.SeedUnread(user, "system")
+
+	repo.afterCount = func() {
+		if _, err := svc.CreateNotification(ctx, &model.Notification{UserID: user, Title: "t", Body: "b"}); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := svc.ReconcileUnreadCounts(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := svc.GetUnreadCounts(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts.Total != 2 {
+		t.Fatalf("cached total is %d after a racing create, want 2", counts.Total)
+	}
+}
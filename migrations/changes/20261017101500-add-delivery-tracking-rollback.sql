@@ -0,0 +1,3 @@
+ALTER TABLE notifications
+DROP COLUMN IF EXISTS delivery_attempts,
+DROP COLUMN IF EXISTS delivered_at;
\ No newline at end of file
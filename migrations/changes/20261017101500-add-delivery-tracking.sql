@@ -0,0 +1,5 @@
+ALTER TABLE notifications
+ADD COLUMN delivered_at TIMESTAMP NULL,
+ADD COLUMN delivery_attempts INT NOT NULL DEFAULT 0;
+
+UPDATE notifications SET delivered_at = read_at WHERE is_read = TRUE;
\ No newline at end of file
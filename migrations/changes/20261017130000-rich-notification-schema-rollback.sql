@@ -0,0 +1,14 @@
+ALTER TABLE notifications
+DROP CONSTRAINT IF EXISTS notifications_metadata_check,
+DROP CONSTRAINT IF EXISTS notifications_target_check,
+DROP CONSTRAINT IF EXISTS notifications_priority_check,
+DROP COLUMN IF EXISTS metadata,
+DROP COLUMN IF EXISTS target_id,
+DROP COLUMN IF EXISTS target_type,
+DROP COLUMN IF EXISTS actor_id,
+DROP COLUMN IF EXISTS priority,
+DROP COLUMN IF EXISTS category,
+DROP COLUMN IF EXISTS type,
+DROP COLUMN IF EXISTS title;
+
+ALTER TABLE notifications RENAME COLUMN body TO message;
\ No newline at end of file
@@ -0,0 +1,29 @@
+-- earlier changesets created, dropped and (on rollback) re-added title and type;
+-- bring every variant of the table to the same shape
+ALTER TABLE notifications RENAME COLUMN message TO body;
+
+ALTER TABLE notifications
+ADD COLUMN IF NOT EXISTS title VARCHAR(255) NOT NULL DEFAULT '',
+ADD COLUMN IF NOT EXISTS type VARCHAR(50) NOT NULL DEFAULT 'system',
+ADD COLUMN category VARCHAR(50) NOT NULL DEFAULT 'system',
+ADD COLUMN priority VARCHAR(16) NOT NULL DEFAULT 'normal',
+ADD COLUMN actor_id UUID NULL,
+ADD COLUMN target_type VARCHAR(50) NULL,
+ADD COLUMN target_id VARCHAR(255) NULL,
+ADD COLUMN metadata JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+ALTER TABLE notifications
+ALTER COLUMN title TYPE VARCHAR(255),
+ALTER COLUMN title SET DEFAULT '',
+ALTER COLUMN type SET DEFAULT 'system',
+ADD CONSTRAINT notifications_priority_check CHECK (priority IN ('low', 'normal', 'high', 'urgent')),
+ADD CONSTRAINT notifications_target_check CHECK ((target_type IS NULL) = (target_id IS NULL)),
+ADD CONSTRAINT notifications_metadata_check CHECK (jsonb_typeof(metadata) = 'object');
+
+UPDATE notifications
+SET type = 'follow', category = 'social', title = 'New follower'
+WHERE body LIKE 'You have a new follower!%';
+
+UPDATE notifications
+SET title = 'Notification'
+WHERE title = '' OR title = 'system';
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- serves keyset pagination and resume in both directions on (created_at, id)
+CREATE INDEX IF NOT EXISTS idx_notifications_user_created_id
+ON notifications (user_id, created_at DESC, id DESC);
\ No newline at end of file